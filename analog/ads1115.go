@@ -0,0 +1,93 @@
+package analog
+
+/* ====================
+Raspberry Pi has no analog inputs, analog probes (pH and the like) are read through an ADS1115 class 16 bit ADC on the I2C bus.
+Driver talks to the ADC over gobot's i2c connection so that it sits alongside the OLED on the raspi adaptor, and tests can hand it a fake bus.
+Conversions are single shot : each read sets the mux & gain, starts a conversion and reads back the result.
+==================== */
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gobot.io/x/gobot/drivers/i2c"
+)
+
+const (
+	ADS1115_ADDR    = 0x48 // ADDR pin to GND
+	ADS1115_BUS     = 1    // same bus as the OLED on RPi
+	REG_CONVERSION  = 0x00
+	REG_CONFIG      = 0x01
+	CONVERSION_WAIT = 10 * time.Millisecond // 128 samples per second takes ~8ms
+)
+
+// Gain : programmable gain amplifier setting, as the full scale range in volts
+type Gain uint8
+
+const (
+	GAIN_6_144V Gain = iota
+	GAIN_4_096V
+	GAIN_2_048V
+	GAIN_1_024V
+	GAIN_0_512V
+	GAIN_0_256V
+)
+
+// FullScale : full scale range in volts for the gain
+func (g Gain) FullScale() float64 {
+	return []float64{6.144, 4.096, 2.048, 1.024, 0.512, 0.256}[g]
+}
+
+// ADS1115 : 4 channel 16 bit ADC on the I2C bus
+type ADS1115 struct {
+	mu   sync.Mutex
+	conn i2c.Connection
+	gain Gain
+}
+
+// NewADS1115 : connects to the ADC on the bus & address
+//
+/*
+	r := raspi.NewAdaptor()
+	r.Connect()
+	adc, err := analog.NewADS1115(r, analog.ADS1115_BUS, analog.ADS1115_ADDR, analog.GAIN_4_096V)
+	volts, err := adc.ReadVolts(0)
+*/
+func NewADS1115(c i2c.Connector, bus, addr int, gain Gain) (*ADS1115, error) {
+	if gain > GAIN_0_256V {
+		return nil, fmt.Errorf("invalid gain for ads1115: %d", gain)
+	}
+	conn, err := c.GetConnection(addr, bus)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ads1115 at 0x%02x on bus %d: %w", addr, bus, err)
+	}
+	return &ADS1115{conn: conn, gain: gain}, nil
+}
+
+// ReadVolts : single ended reading on the channel 0-3
+func (ads *ADS1115) ReadVolts(channel int) (float64, error) {
+	if channel < 0 || channel > 3 {
+		return 0, fmt.Errorf("invalid ads1115 channel %d, expected 0-3", channel)
+	}
+	ads.mu.Lock()
+	defer ads.mu.Unlock()
+	cfg := uint16(0x8000) | // start a single conversion
+		uint16(0x4+channel)<<12 | // single ended against GND
+		uint16(ads.gain)<<9 |
+		0x0100 | // single shot mode
+		0x0080 | // 128 samples per second
+		0x0003 // comparator off
+	if err := ads.conn.WriteBlockData(REG_CONFIG, []byte{byte(cfg >> 8), byte(cfg)}); err != nil {
+		return 0, fmt.Errorf("failed to start ads1115 conversion: %w", err)
+	}
+	time.Sleep(CONVERSION_WAIT)
+	if _, err := ads.conn.Write([]byte{REG_CONVERSION}); err != nil {
+		return 0, fmt.Errorf("failed to select ads1115 conversion register: %w", err)
+	}
+	buf := make([]byte, 2)
+	if n, err := ads.conn.Read(buf); err != nil || n != 2 {
+		return 0, fmt.Errorf("failed to read ads1115 conversion: %v", err)
+	}
+	raw := int16(uint16(buf[0])<<8 | uint16(buf[1]))
+	return float64(raw) * ads.gain.FullScale() / 32768, nil
+}
@@ -0,0 +1,133 @@
+package analog
+
+/* ====================
+pH probe through an analog front end (PH-4502C and the like) read on the ADC.
+Probe voltage is linear in pH, but the slope & offset drift with every probe and with age, hence the calibration against buffer solutions
+- 2 point : a single line through both buffers
+- 3 point : 2 lines meeting at the middle buffer, acid & base sides of the probe are rarely the same slope
+Slope of the probe is proportional to the absolute temperature (Nernst), readings are compensated to the water temperature around the isopotential point (pH 7, or the middle buffer).
+Readings are the median of a burst of samples, that knocks off the spikes from pump motors on the same supply.
+==================== */
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	KELVIN          = 273.15
+	DEFAULT_CALTEMP = 25.0 // buffers are usually specified at 25°C
+	DEFAULT_SAMPLES = 9
+)
+
+var (
+	ErrCalibration = errors.New("invalid pH calibration")
+)
+
+// VoltReader : anything that can read volts on a channel, ADS1115 for one
+type VoltReader interface {
+	ReadVolts(channel int) (float64, error)
+}
+
+// CalPoint : probe voltage in a buffer solution of known pH
+type CalPoint struct {
+	PH    float64
+	Volts float64
+}
+
+// PHProbe : pH probe on a channel of the ADC
+type PHProbe struct {
+	adc     VoltReader
+	channel int
+	points  []CalPoint // sorted by volts
+	calTemp float64    // temperature at which the probe was calibrated
+	samples int        // median of these many samples makes a reading
+}
+
+// NewPHProbe : ctor for the probe, needs 2 or 3 calibration points
+// calTemp	: temperature of the buffers at calibration, 0 for 25°C
+// samples	: samples per reading for median filtering, 0 for the default 9
+//
+/*
+	probe, err := analog.NewPHProbe(adc, 0, []analog.CalPoint{
+		{PH: 4.01, Volts: 3.05},
+		{PH: 6.86, Volts: 2.54},
+		{PH: 9.18, Volts: 2.11},
+	}, 25, 9)
+	ph, err := probe.Read(waterTemp)
+*/
+func NewPHProbe(adc VoltReader, channel int, points []CalPoint, calTemp float64, samples int) (*PHProbe, error) {
+	if len(points) != 2 && len(points) != 3 {
+		return nil, fmt.Errorf("%w: need 2 or 3 points, got %d", ErrCalibration, len(points))
+	}
+	sorted := append([]CalPoint{}, points...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Volts < sorted[j].Volts })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Volts == sorted[i-1].Volts || sorted[i].PH == sorted[i-1].PH {
+			return nil, fmt.Errorf("%w: points have to be distinct", ErrCalibration)
+		}
+		if (sorted[i].PH > sorted[i-1].PH) != (sorted[1].PH > sorted[0].PH) {
+			return nil, fmt.Errorf("%w: pH has to be monotonic in volts", ErrCalibration)
+		}
+	}
+	if calTemp == 0 {
+		calTemp = DEFAULT_CALTEMP
+	}
+	if samples <= 0 {
+		samples = DEFAULT_SAMPLES
+	}
+	return &PHProbe{adc: adc, channel: channel, points: sorted, calTemp: calTemp, samples: samples}, nil
+}
+
+// isopotential : pH around which the temperature compensation pivots
+func (pp *PHProbe) isopotential() float64 {
+	if len(pp.points) == 3 {
+		return pp.points[1].PH
+	}
+	return 7.0
+}
+
+// PH : converts the probe voltage to pH at the water temperature
+// celsius	: water temperature, NaN when not known - no compensation then
+func (pp *PHProbe) PH(volts, celsius float64) float64 {
+	// segment of the calibration the voltage falls in, extrapolated at the ends
+	lo, hi := pp.points[0], pp.points[1]
+	if len(pp.points) == 3 && volts > pp.points[1].Volts {
+		lo, hi = pp.points[1], pp.points[2]
+	}
+	ph := lo.PH + (volts-lo.Volts)*(hi.PH-lo.PH)/(hi.Volts-lo.Volts)
+	if math.IsNaN(celsius) {
+		return ph
+	}
+	iso := pp.isopotential()
+	return iso + (ph-iso)*(pp.calTemp+KELVIN)/(celsius+KELVIN)
+}
+
+// Read : median filtered pH reading, compensated to the water temperature
+func (pp *PHProbe) Read(celsius float64) (float64, error) {
+	volts := make([]float64, 0, pp.samples)
+	var lastErr error
+	for i := 0; i < pp.samples; i++ {
+		v, err := pp.adc.ReadVolts(pp.channel)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		volts = append(volts, v)
+	}
+	if len(volts) == 0 {
+		return 0, fmt.Errorf("failed to read pH probe: %w", lastErr)
+	}
+	return pp.PH(Median(volts), celsius), nil
+}
+
+// Median : median of the values, values are sorted in place
+func Median(values []float64) float64 {
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
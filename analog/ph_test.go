@@ -0,0 +1,114 @@
+package analog
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gobot.io/x/gobot/drivers/i2c"
+)
+
+// fakeBus : stands in for the I2C bus with an ADS1115 on it
+// conversion register returns the raw value set for the channel in the last config write
+type fakeBus struct {
+	raw     map[int][]int16 // per channel, readings are played in order and the last one repeats
+	pointer byte
+	config  uint16
+	writes  int
+}
+
+func (fb *fakeBus) GetConnection(address int, bus int) (i2c.Connection, error) {
+	if address != ADS1115_ADDR || bus != ADS1115_BUS {
+		return nil, errors.New("no device at address")
+	}
+	return fb, nil
+}
+func (fb *fakeBus) GetDefaultBus() int { return ADS1115_BUS }
+
+func (fb *fakeBus) channel() int { return int(fb.config>>12&0x7) - 4 }
+
+func (fb *fakeBus) Read(b []byte) (int, error) {
+	if fb.pointer != REG_CONVERSION {
+		return 0, errors.New("unexpected register read")
+	}
+	ch := fb.channel()
+	vals := fb.raw[ch]
+	val := vals[0]
+	if len(vals) > 1 {
+		fb.raw[ch] = vals[1:]
+	}
+	b[0], b[1] = byte(uint16(val)>>8), byte(uint16(val))
+	return 2, nil
+}
+func (fb *fakeBus) Write(b []byte) (int, error) {
+	fb.pointer = b[0]
+	return len(b), nil
+}
+func (fb *fakeBus) WriteBlockData(reg uint8, b []byte) error {
+	if reg != REG_CONFIG || len(b) != 2 {
+		return errors.New("unexpected block write")
+	}
+	fb.config = uint16(b[0])<<8 | uint16(b[1])
+	fb.writes++
+	return nil
+}
+func (fb *fakeBus) Close() error                              { return nil }
+func (fb *fakeBus) ReadByte() (byte, error)                   { return 0, nil }
+func (fb *fakeBus) ReadByteData(reg uint8) (uint8, error)     { return 0, nil }
+func (fb *fakeBus) ReadWordData(reg uint8) (uint16, error)    { return 0, nil }
+func (fb *fakeBus) WriteByte(val byte) error                  { return nil }
+func (fb *fakeBus) WriteByteData(reg uint8, val uint8) error  { return nil }
+func (fb *fakeBus) WriteWordData(reg uint8, val uint16) error { return nil }
+
+// rawFor : raw conversion for the volts at gain 4.096V
+func rawFor(volts float64) int16 {
+	return int16(math.Round(volts * 32768 / 4.096))
+}
+
+func TestADS1115Read(t *testing.T) {
+	bus := &fakeBus{raw: map[int][]int16{2: {rawFor(1.5)}}}
+	adc, err := NewADS1115(bus, ADS1115_BUS, ADS1115_ADDR, GAIN_4_096V)
+	assert.Nil(t, err)
+	v, err := adc.ReadVolts(2)
+	assert.Nil(t, err)
+	assert.InDelta(t, 1.5, v, 0.001)
+	assert.Equal(t, uint16(0xE383), bus.config, "single shot on AIN2, 4.096V, 128SPS, comparator off")
+
+	_, err = adc.ReadVolts(4)
+	assert.NotNil(t, err)
+	_, err = NewADS1115(bus, ADS1115_BUS, 0x49, GAIN_4_096V)
+	assert.NotNil(t, err)
+}
+
+func TestPHProbe(t *testing.T) {
+	points := []CalPoint{{PH: 4.0, Volts: 3.0}, {PH: 7.0, Volts: 2.5}, {PH: 10.0, Volts: 2.1}}
+	// spikes from the motor are knocked off by the median
+	bus := &fakeBus{raw: map[int][]int16{0: {rawFor(2.5), rawFor(0.1), rawFor(2.5), rawFor(4.0), rawFor(2.5)}}}
+	adc, _ := NewADS1115(bus, ADS1115_BUS, ADS1115_ADDR, GAIN_4_096V)
+	probe, err := NewPHProbe(adc, 0, points, 25, 5)
+	assert.Nil(t, err)
+	ph, err := probe.Read(math.NaN())
+	assert.Nil(t, err)
+	assert.InDelta(t, 7.0, ph, 0.01)
+	assert.Equal(t, 5, bus.writes)
+
+	// 3 point calibration has different slopes for acid and base sides
+	assert.InDelta(t, 5.5, probe.PH(2.75, math.NaN()), 0.001)
+	assert.InDelta(t, 8.5, probe.PH(2.3, math.NaN()), 0.001)
+
+	// warmer water has a steeper slope, same volts read closer to neutral
+	assert.InDelta(t, 4.0, probe.PH(3.0, 25), 0.001)
+	warm := probe.PH(3.0, 35)
+	assert.True(t, warm > 4.0 && warm < 7.0, "Unexpected compensated pH %f", warm)
+	assert.InDelta(t, 7.0, probe.PH(2.5, 35), 0.001, "isopotential point does not shift")
+
+	two, err := NewPHProbe(adc, 0, points[:2], 0, 0)
+	assert.Nil(t, err)
+	assert.InDelta(t, 10.0, two.PH(2.0, math.NaN()), 0.001, "2 point calibration extrapolates")
+
+	_, err = NewPHProbe(adc, 0, points[:1], 25, 5)
+	assert.True(t, errors.Is(err, ErrCalibration))
+	_, err = NewPHProbe(adc, 0, []CalPoint{{PH: 4, Volts: 3}, {PH: 7, Volts: 3}}, 25, 5)
+	assert.True(t, errors.Is(err, ErrCalibration))
+}
@@ -0,0 +1,95 @@
+package api
+
+/* ====================
+Local API to check on and control the device without ssh & journalctl, from a phone on the farm wifi for instance, or with patioctl on the box itself.
+Api does not know the insides of the application, main wires up a Backend with what can be seen and done.
+Configuration that comes in is validated here through aquacfg before the backend gets to see it.
+==================== */
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/eensymachines-in/patio/aquacfg"
+	"github.com/eensymachines-in/patio/sensors"
+)
+
+const (
+	ORIGIN_HTTP = "http" // origin of the commands that come in over the api
+	ORIGIN_CLI  = "cli"  // origin of the commands that come in on the control socket
+)
+
+var (
+	ErrNoRelay       = errors.New("no such relay")
+	ErrInvalidConfig = errors.New("invalid configuration")
+	ErrNoAlarm       = errors.New("no alarm to acknowledge")
+)
+
+// Backend : what the api can see & do in the application
+type Backend struct {
+	Config        func() aquacfg.AppConfig                               // configuration in force
+	SetConfig     func(cfg aquacfg.AppConfig) error                      // replaces the configuration, cfg is valid already
+	Relays        func() []RelayState                                    // state of all the relays
+	Next          func() []Transition                                    // upcoming relay switches, soonest first
+	Sensors       func() []sensors.Reading                               // latest readings from all the sensors
+	Override      func(relay string, args []string, origin string) error // manual override, args as in control.ParseOverride
+	Reload        func() error                                           // reads the configuration file afresh
+	Acknowledge   func() error                                           // clears the latched leak alarm, ErrNoAlarm when there is none
+	Status        func() map[string]interface{}                          // all that an operator would want to know, as in the status dump
+	Broker        func() bool                                            // link to the broker is up
+	ConfigVersion func() int64                                           // goes up every time a configuration is applied
+}
+
+// RelayState : state of one relay and why it is in that state
+type RelayState struct {
+	Name     string     `json:"name"`
+	On       bool       `json:"on"`
+	Source   string     `json:"source"` // source of the request in force
+	Reason   string     `json:"reason"`
+	Until    *time.Time `json:"until,omitempty"` // request in force expires at
+	Hours    float64    `json:"hours"`           // cumulative on-time
+	Switches int64      `json:"switches"`
+	LastOn   *time.Time `json:"last_on,omitempty"`  // relay was last closed at, nil if never
+	LastOff  *time.Time `json:"last_off,omitempty"` // relay was last opened at, nil if never
+	Err      string     `json:"err,omitempty"`      // relay did not switch as decided
+}
+
+// Transition : one upcoming switch of a relay
+type Transition struct {
+	Relay  string    `json:"relay"`
+	At     time.Time `json:"at"`
+	On     bool      `json:"on"`
+	Source string    `json:"source"` // schedule, or the override that expires
+}
+
+// SensorState : latest reading of a sensor
+type SensorState struct {
+	ID    string    `json:"id"`
+	Unit  string    `json:"unit"`
+	At    time.Time `json:"at"`
+	Value *float64  `json:"value"` // null when the sensor has no good reading
+	Raw   *float64  `json:"raw"`
+	Err   string    `json:"err,omitempty"`
+}
+
+// sensorState : readings as sent out, NaN does not go in json
+func sensorState(rd sensors.Reading) SensorState {
+	st := SensorState{ID: rd.ID, Unit: rd.Unit, At: rd.At}
+	if rd.Err != nil {
+		st.Err = rd.Err.Error()
+	}
+	if !math.IsNaN(rd.Value) && rd.Err == nil {
+		v, raw := rd.Value, rd.Raw
+		st.Value, st.Raw = &v, &raw
+	}
+	return st
+}
+
+// sensorStates : all the readings as sent out
+func sensorStates(rds []sensors.Reading) []SensorState {
+	states := []SensorState{}
+	for _, rd := range rds {
+		states = append(states, sensorState(rd))
+	}
+	return states
+}
@@ -0,0 +1,163 @@
+package api
+
+/* ====================
+Metrics for Prometheus on /metrics, so that the pump controller can be graphed along with the rest of the farm.
+Exposition is written by hand, it is a handful of gauges & counters and not worth a client library on the pi.
+Prometheus asks for OpenMetrics and gets it, anyone else (curl) gets the plain text format 0.0.4 - the two differ only in the counter names on the TYPE lines and the trailing # EOF.
+==================== */
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CONTENT_OPENMETRICS = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	CONTENT_PROMTEXT    = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	started = time.Now() // for uptime, close enough to the process start
+)
+
+// metricWriter : writes out the metric families one after the other
+type metricWriter struct {
+	w           io.Writer
+	openMetrics bool
+}
+
+// family : HELP & TYPE lines of the metric family, counters are named without the _total suffix
+func (mw *metricWriter) family(name, typ, help string) {
+	if typ == "counter" && !mw.openMetrics {
+		name += "_total" // text format has the counter named as the samples are
+	}
+	fmt.Fprintf(mw.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample : one sample of the family, labels in pairs of name & value
+func (mw *metricWriter) sample(name string, value float64, labels ...string) {
+	pairs := []string{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], escapeLabel(labels[i+1])))
+	}
+	if len(pairs) > 0 {
+		name = fmt.Sprintf("%s{%s}", name, strings.Join(pairs, ","))
+	}
+	fmt.Fprintf(mw.w, "%s %s\n", name, formatValue(value))
+}
+
+func (mw *metricWriter) end() {
+	if mw.openMetrics {
+		fmt.Fprint(mw.w, "# EOF\n")
+	}
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// metrics : GET all the metrics
+func (s *Server) metrics(w http.ResponseWriter, r *http.Request) {
+	if !only(w, r, http.MethodGet) {
+		return
+	}
+	mw := &metricWriter{w: w, openMetrics: strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")}
+	if mw.openMetrics {
+		w.Header().Set("Content-Type", CONTENT_OPENMETRICS)
+	} else {
+		w.Header().Set("Content-Type", CONTENT_PROMTEXT)
+	}
+	now := time.Now()
+
+	relays := s.backend.Relays()
+	mw.family("patio_relay_on", "gauge", "Relay closed (1) or open (0).")
+	for _, rl := range relays {
+		mw.sample("patio_relay_on", boolValue(rl.On), "relay", rl.Name)
+	}
+	// source is kept off patio_relay_on, else every change of source starts a new series of the relay state
+	mw.family("patio_relay_source", "gauge", "Source of the request in force on the relay, always 1.")
+	for _, rl := range relays {
+		mw.sample("patio_relay_source", 1, "relay", rl.Name, "source", rl.Source)
+	}
+	mw.family("patio_relay_switches", "counter", "Switches of the relay, on and off both count, across restarts.")
+	for _, rl := range relays {
+		mw.sample("patio_relay_switches_total", float64(rl.Switches), "relay", rl.Name)
+	}
+	mw.family("patio_relay_on_seconds", "counter", "Cumulative time the relay has been closed, across restarts.")
+	for _, rl := range relays {
+		mw.sample("patio_relay_on_seconds_total", rl.Hours*3600, "relay", rl.Name)
+	}
+	mw.family("patio_relay_last_on_timestamp_seconds", "gauge", "Unix time the relay was last closed.")
+	for _, rl := range relays {
+		if rl.LastOn != nil {
+			mw.sample("patio_relay_last_on_timestamp_seconds", float64(rl.LastOn.Unix()), "relay", rl.Name)
+		}
+	}
+	mw.family("patio_relay_last_off_timestamp_seconds", "gauge", "Unix time the relay was last opened.")
+	for _, rl := range relays {
+		if rl.LastOff != nil {
+			mw.sample("patio_relay_last_off_timestamp_seconds", float64(rl.LastOff.Unix()), "relay", rl.Name)
+		}
+	}
+
+	mw.family("patio_schedule_next_transition_seconds", "gauge", "Seconds till the next scheduled switch of the relay.")
+	seen := map[string]bool{}
+	for _, tr := range s.backend.Next() {
+		if seen[tr.Relay] {
+			continue // soonest only
+		}
+		seen[tr.Relay] = true
+		mw.sample("patio_schedule_next_transition_seconds", math.Max(0, tr.At.Sub(now).Seconds()), "relay", tr.Relay, "on", strconv.FormatBool(tr.On), "source", tr.Source)
+	}
+
+	sensors := sensorStates(s.backend.Sensors())
+	mw.family("patio_sensor_value", "gauge", "Latest good reading of the sensor, filtered.")
+	for _, st := range sensors {
+		if st.Value != nil {
+			mw.sample("patio_sensor_value", *st.Value, "sensor", st.ID, "unit", st.Unit)
+		}
+	}
+	mw.family("patio_sensor_timestamp_seconds", "gauge", "Unix time of the latest good reading of the sensor.")
+	for _, st := range sensors {
+		if st.Value != nil {
+			mw.sample("patio_sensor_timestamp_seconds", float64(st.At.UnixMilli())/1000, "sensor", st.ID)
+		}
+	}
+
+	mw.family("patio_amqp_connected", "gauge", "Link to the AMQP broker is up (1) or down (0).")
+	mw.sample("patio_amqp_connected", boolValue(s.backend.Broker()))
+	mw.family("patio_config_version", "gauge", "Configurations applied since the start, goes up with every reload.")
+	mw.sample("patio_config_version", float64(s.backend.ConfigVersion()))
+
+	mw.family("go_goroutines", "gauge", "Number of goroutines that currently exist.")
+	mw.sample("go_goroutines", float64(runtime.NumGoroutine()))
+	mw.family("process_start_time_seconds", "gauge", "Start time of the process since unix epoch in seconds.")
+	mw.sample("process_start_time_seconds", float64(started.Unix()))
+	mw.family("patio_uptime_seconds", "gauge", "Seconds since the service started.")
+	mw.sample("patio_uptime_seconds", now.Sub(started).Seconds())
+	mw.end()
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eensymachines-in/patio/aquacfg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	cfg := aquacfg.AppConfig{}
+	h := NewServer("", testBackend(&cfg, &[]string{})).Handler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, CONTENT_PROMTEXT, rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	for _, line := range []string{
+		`# TYPE patio_relay_switches_total counter`,
+		`patio_relay_on{relay="pump"} 1`,
+		`patio_relay_source{relay="pump",source="schedule"} 1`,
+		`patio_relay_switches_total{relay="pump"} 0`,
+		`patio_relay_last_on_timestamp_seconds{relay="pump"} 1.7092836e+09`,
+		`patio_sensor_value{sensor="ph",unit="pH"} 7.1`,
+		`patio_amqp_connected 1`,
+		`patio_config_version 3`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+	assert.NotContains(t, body, `sensor="tank"`, "failed reading is left out")
+	assert.NotContains(t, body, `patio_relay_last_off_timestamp_seconds{`, "relay never opened")
+	assert.NotContains(t, body, "# EOF")
+	assert.Contains(t, body, `patio_schedule_next_transition_seconds{relay="pump",on="false",source="schedule"} 0`, "transition in the past is due now")
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0,text/plain;version=0.0.4;q=0.5")
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, CONTENT_OPENMETRICS, rec.Header().Get("Content-Type"))
+	body = rec.Body.String()
+	assert.Contains(t, body, "# TYPE patio_relay_switches counter\n", "openmetrics counter family has no suffix")
+	assert.Contains(t, body, `patio_relay_switches_total{relay="pump"} 0`+"\n")
+	assert.True(t, strings.HasSuffix(body, "# EOF\n"))
+}
+
+func TestEscapeLabel(t *testing.T) {
+	assert.Equal(t, `a\"b\\c\nd`, escapeLabel("a\"b\\c\nd"))
+	assert.Equal(t, "NaN", formatValue(math.NaN()))
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eensymachines-in/patio/aquacfg"
+	"github.com/eensymachines-in/patio/control"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrNoControl    = errors.New("control over the api is not enabled")
+	ErrUnauthorized = errors.New("missing or wrong token")
+)
+
+const (
+	SHUTDOWN_GRACE = 2 * time.Second // requests in flight have this long to complete when the application goes down
+	MAX_BODY       = 64 << 10        // largest request body accepted
+)
+
+// Server : http server for the api
+type Server struct {
+	addr    string
+	backend Backend
+	mux     *http.ServeMux
+	token   string // bearer token for the requests that change anything, empty and the api is read only
+}
+
+// NewServer : ctor for the api server on the address
+//
+/*
+	srv := api.NewServer(":8080", api.Backend{Config: func() aquacfg.AppConfig { return *live.Load() }, ...})
+	if err := srv.Start(ctx, &wg); err != nil {
+		log.Errorf("api not available: %s", err)
+	}
+	// curl http://aquapone.local:8080/api/relays
+	// curl -H "Authorization: Bearer $HTTP_TOKEN" -X POST -d '{"relay":"pump","state":"resume"}' http://aquapone.local:8080/api/override
+*/
+func NewServer(addr string, be Backend) *Server {
+	s := &Server{addr: addr, backend: be, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/api/config", s.config)
+	s.mux.HandleFunc("/api/relays", s.relays)
+	s.mux.HandleFunc("/api/schedule/next", s.next)
+	s.mux.HandleFunc("/api/sensors", s.sensors)
+	s.mux.HandleFunc("/api/override", s.override)
+	s.mux.HandleFunc("/metrics", s.metrics)
+	return s
+}
+
+// WithToken : requests that change the configuration or the relays need the token as `Authorization: Bearer <token>`
+// Without a token such requests are refused altogether, scraping /metrics should not hand out control of the pump
+func (s *Server) WithToken(token string) *Server {
+	s.token = token
+	return s
+}
+
+// Handler : all the endpoints of the api
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Start : listens on the address and serves till the context is done
+// error when the address cannot be had
+func (s *Server) Start(ctx context.Context, wg *sync.WaitGroup) error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+	}
+	srv := &http.Server{Handler: s.mux, ReadHeaderTimeout: 10 * time.Second}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		logrus.WithFields(logrus.Fields{"addr": ln.Addr().String()}).Info("api listening")
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.Errorf("api server stopped: %s", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		defer logrus.Warn("Now closing api server..")
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_GRACE)
+		defer cancel()
+		srv.Shutdown(sctx)
+	}()
+	return nil
+}
+
+// reply : sends out the body as json with the status
+func reply(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logrus.Warnf("api reply failed: %s", err)
+	}
+}
+
+// fail : sends out the error as json, status as per the kind of the error
+func fail(w http.ResponseWriter, status int, err error) {
+	reply(w, status, map[string]string{"error": err.Error()})
+}
+
+// only : true when the request has the method, else replies 405
+func only(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	fail(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	return false
+}
+
+// authorized : true when the request carries the token, else replies 403 when there is no token to check against or 401
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if s.token == "" {
+		fail(w, http.StatusForbidden, ErrNoControl)
+		return false
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) != 1 {
+		logrus.WithFields(logrus.Fields{"remote": r.RemoteAddr, "path": r.URL.Path}).Warn("api request with missing or wrong token")
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		fail(w, http.StatusUnauthorized, ErrUnauthorized)
+		return false
+	}
+	return true
+}
+
+// decode : reads the json body into v
+// strict for requests where unknown fields are typos that should not go unnoticed
+func decode(w http.ResponseWriter, r *http.Request, v interface{}, strict bool) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_BODY))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	return dec.Decode(v)
+}
+
+// config : GET the configuration in force, POST replaces it
+func (s *Server) config(w http.ResponseWriter, r *http.Request) {
+	if !only(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+	if r.Method == http.MethodGet {
+		reply(w, http.StatusOK, s.backend.Config())
+		return
+	}
+	if !s.authorized(w, r) {
+		return
+	}
+	cfg := aquacfg.AppConfig{}
+	if err := decode(w, r, &cfg, false); err != nil {
+		fail(w, http.StatusBadRequest, fmt.Errorf("%w: %s", ErrInvalidConfig, err))
+		return
+	}
+	if !cfg.IsValid() {
+		fail(w, http.StatusUnprocessableEntity, ErrInvalidConfig)
+		return
+	}
+	if err := s.backend.SetConfig(cfg); err != nil {
+		fail(w, http.StatusInternalServerError, err)
+		return
+	}
+	logrus.WithFields(logrus.Fields{"remote": r.RemoteAddr}).Info("configuration replaced over the api")
+	reply(w, http.StatusOK, s.backend.Config())
+}
+
+// relays : GET state of all the relays
+func (s *Server) relays(w http.ResponseWriter, r *http.Request) {
+	if !only(w, r, http.MethodGet) {
+		return
+	}
+	reply(w, http.StatusOK, s.backend.Relays())
+}
+
+// next : GET upcoming relay switches
+func (s *Server) next(w http.ResponseWriter, r *http.Request) {
+	if !only(w, r, http.MethodGet) {
+		return
+	}
+	reply(w, http.StatusOK, s.backend.Next())
+}
+
+// sensors : GET latest readings of all the sensors
+func (s *Server) sensors(w http.ResponseWriter, r *http.Request) {
+	if !only(w, r, http.MethodGet) {
+		return
+	}
+	reply(w, http.StatusOK, sensorStates(s.backend.Sensors()))
+}
+
+// OverrideRequest : body of the override request
+//
+/*
+	{"relay": "pump", "state": "on", "for": "10m"}
+	{"relay": "pump", "state": "off", "until": "15:30"}
+	{"relay": "pump", "state": "resume"}
+*/
+type OverrideRequest struct {
+	Relay string `json:"relay"`
+	State string `json:"state"`           // on, off or resume - flips the relay when empty
+	For   string `json:"for,omitempty"`   // duration like 10m
+	Until string `json:"until,omitempty"` // clock time like 15:30
+}
+
+// Args : override request as the command args
+func (or OverrideRequest) Args() ([]string, error) {
+	if or.For != "" && or.Until != "" {
+		return nil, fmt.Errorf("%w: either for or until, not both", control.ErrOverrideArgs)
+	}
+	args := []string{}
+	if or.State != "" {
+		args = append(args, or.State)
+	}
+	if or.For != "" {
+		args = append(args, or.For)
+	}
+	if or.Until != "" {
+		args = append(args, or.Until)
+	}
+	return args, nil
+}
+
+// override : POST manual override of a relay, replies with the relay states
+func (s *Server) override(w http.ResponseWriter, r *http.Request) {
+	if !only(w, r, http.MethodPost) || !s.authorized(w, r) {
+		return
+	}
+	req := OverrideRequest{}
+	if err := decode(w, r, &req, true); err != nil {
+		fail(w, http.StatusBadRequest, err)
+		return
+	}
+	args, err := req.Args()
+	if err == nil {
+		err = s.backend.Override(req.Relay, args, ORIGIN_HTTP)
+	}
+	switch {
+	case err == nil:
+		reply(w, http.StatusOK, s.backend.Relays())
+	case errors.Is(err, control.ErrOverrideArgs):
+		fail(w, http.StatusBadRequest, err)
+	case errors.Is(err, ErrNoRelay):
+		fail(w, http.StatusNotFound, err)
+	case errors.Is(err, control.ErrOverruled):
+		fail(w, http.StatusConflict, err)
+	default:
+		fail(w, http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eensymachines-in/patio/aquacfg"
+	"github.com/eensymachines-in/patio/control"
+	"github.com/eensymachines-in/patio/sensors"
+	"github.com/stretchr/testify/assert"
+)
+
+const testToken = "s3cret"
+
+// testBackend : backend over a config & a single relay
+func testBackend(cfg *aquacfg.AppConfig, overrides *[]string) Backend {
+	return Backend{
+		Config: func() aquacfg.AppConfig { return *cfg },
+		SetConfig: func(c aquacfg.AppConfig) error {
+			*cfg = c
+			return nil
+		},
+		Relays: func() []RelayState {
+			lastOn := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+			return []RelayState{{Name: "pump", On: true, Source: "schedule", Reason: "tick", LastOn: &lastOn}}
+		},
+		Next: func() []Transition {
+			return []Transition{{Relay: "pump", At: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), On: false, Source: "schedule"}}
+		},
+		Sensors: func() []sensors.Reading {
+			return []sensors.Reading{
+				{ID: "ph", Unit: "pH", Value: 7.1, Raw: 7.3},
+				{ID: "tank", Unit: "L", Value: math.NaN(), Err: errors.New("no echo")},
+			}
+		},
+		Override: func(relay string, args []string, origin string) error {
+			if relay != "pump" {
+				return fmt.Errorf("%w: %s", ErrNoRelay, relay)
+			}
+			if len(args) > 0 && args[0] == "on" && len(args) == 1 {
+				return fmt.Errorf("%w by safety: dry run", control.ErrOverruled)
+			}
+			*overrides = append(*overrides, fmt.Sprintf("%s %v", origin, args))
+			return nil
+		},
+		Reload: func() error { return nil },
+		Acknowledge: func() error {
+			return ErrNoAlarm
+		},
+		Status: func() map[string]interface{} {
+			return map[string]interface{}{"broker": "up"}
+		},
+		Broker:        func() bool { return true },
+		ConfigVersion: func() int64 { return 3 },
+	}
+}
+
+func call(t *testing.T, h http.Handler, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		assert.Nil(t, json.NewEncoder(&buf).Encode(body))
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServerGets(t *testing.T) {
+	cfg := aquacfg.AppConfig{AppName: "test", Schedule: aquacfg.Schedule{Config: aquacfg.TICK_EVERY, Interval: 60}}
+	h := NewServer("", testBackend(&cfg, &[]string{})).Handler()
+
+	rec := call(t, h, http.MethodGet, "/api/config", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	got := aquacfg.AppConfig{}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, cfg, got)
+
+	rec = call(t, h, http.MethodGet, "/api/relays", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"source":"schedule"`)
+
+	rec = call(t, h, http.MethodGet, "/api/schedule/next", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"at":"2024-03-01T10:00:00Z"`)
+
+	rec = call(t, h, http.MethodGet, "/api/sensors", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	states := []SensorState{}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &states))
+	assert.Len(t, states, 2)
+	assert.Equal(t, 7.1, *states[0].Value)
+	assert.Nil(t, states[1].Value, "failed reading has no value")
+	assert.Equal(t, "no echo", states[1].Err)
+
+	rec = call(t, h, http.MethodDelete, "/api/relays", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestServerConfig(t *testing.T) {
+	cfg := aquacfg.AppConfig{AppName: "test", Schedule: aquacfg.Schedule{Config: aquacfg.TICK_EVERY, Interval: 60}}
+	h := NewServer("", testBackend(&cfg, &[]string{})).WithToken(testToken).Handler()
+
+	bad := cfg
+	bad.Relay.MinOn = -1
+	rec := call(t, h, http.MethodPost, "/api/config", bad)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code, "invalid configuration is rejected")
+	assert.Equal(t, 0, cfg.Relay.MinOn)
+
+	good := cfg
+	good.Schedule.Interval = 120
+	rec = call(t, h, http.MethodPost, "/api/config", good)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 120, cfg.Schedule.Interval)
+
+	rec = call(t, h, http.MethodPost, "/api/config", "not a config")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestServerOverride(t *testing.T) {
+	cfg := aquacfg.AppConfig{}
+	overrides := []string{}
+	h := NewServer("", testBackend(&cfg, &overrides)).WithToken(testToken).Handler()
+
+	data := []struct {
+		body   interface{}
+		status int
+	}{
+		{OverrideRequest{Relay: "pump", State: "on", For: "10m"}, http.StatusOK},
+		{OverrideRequest{Relay: "pump", State: "off", Until: "15:30"}, http.StatusOK},
+		{OverrideRequest{Relay: "pump", State: "resume"}, http.StatusOK},
+		{OverrideRequest{Relay: "pump", State: "on"}, http.StatusConflict},
+		{OverrideRequest{Relay: "drain", State: "on", For: "10m"}, http.StatusNotFound},
+		{OverrideRequest{Relay: "pump", For: "10m", Until: "15:30"}, http.StatusBadRequest},
+		{map[string]string{"relay": "pump", "sate": "on"}, http.StatusBadRequest},
+	}
+	for _, d := range data {
+		rec := call(t, h, http.MethodPost, "/api/override", d.body)
+		assert.Equal(t, d.status, rec.Code, "Unexpected status for %v: %s", d.body, rec.Body.String())
+	}
+	assert.Equal(t, []string{"http [on 10m]", "http [off 15:30]", "http [resume]"}, overrides)
+}
+
+func TestServerToken(t *testing.T) {
+	cfg := aquacfg.AppConfig{AppName: "test", Schedule: aquacfg.Schedule{Config: aquacfg.TICK_EVERY, Interval: 60}}
+	overrides := []string{}
+	body := OverrideRequest{Relay: "pump", State: "on", For: "10m"}
+
+	h := NewServer("", testBackend(&cfg, &overrides)).Handler()
+	assert.Equal(t, http.StatusForbidden, call(t, h, http.MethodPost, "/api/override", body).Code, "no token, no control")
+	assert.Equal(t, http.StatusForbidden, call(t, h, http.MethodPost, "/api/config", cfg).Code)
+	assert.Equal(t, http.StatusOK, call(t, h, http.MethodGet, "/api/config", nil).Code, "reading is still open")
+	assert.Equal(t, http.StatusOK, call(t, h, http.MethodGet, "/metrics", nil).Code)
+
+	h = NewServer("", testBackend(&cfg, &overrides)).WithToken("other").Handler()
+	rec := call(t, h, http.MethodPost, "/api/override", body)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "wrong token")
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	assert.Empty(t, overrides, "none of the refused requests should have reached the backend")
+}
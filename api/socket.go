@@ -0,0 +1,215 @@
+package api
+
+/* ====================
+Control socket for patioctl, so that operators logged in on the box need not edit json and restart the service to get anything done.
+Protocol is one json request and one json reply per connection
+
+	{"cmd": "relay", "args": ["pump", "on", "10m"]}
+	{"data": [{"name": "pump", "on": true, "source": "manual", ...}]}
+	{"error": "request overruled by safety: low water float is dry"}
+
+There is no authentication, the socket file mode is what decides who can connect : owner & group of the service only.
+==================== */
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DEFAULT_SOCKET = "/run/aquapone/patioctl.sock"
+	SOCKET_MODE    = 0660             // owner & group of the service can connect, others cannot
+	SOCKET_TIMEOUT = 10 * time.Second // a connection has this long for the request and the reply
+)
+
+var (
+	ErrUnknownCmd = errors.New("unknown command")
+)
+
+// ControlRequest : request on the control socket
+type ControlRequest struct {
+	Cmd  string   `json:"cmd"`
+	Args []string `json:"args,omitempty"`
+}
+
+// ControlReply : reply on the control socket, either of data or error
+type ControlReply struct {
+	Data  interface{} `json:"data,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+// ControlSocket : unix socket that takes commands from patioctl
+type ControlSocket struct {
+	path    string
+	backend Backend
+}
+
+// NewControlSocket : ctor for the control socket at the path, empty for DEFAULT_SOCKET
+//
+/*
+	cs := api.NewControlSocket("", backend)
+	if err := cs.Start(ctx, &wg); err != nil {
+		log.Errorf("control socket not available: %s", err)
+	}
+	// patioctl relay pump on --for 10m
+*/
+func NewControlSocket(path string, be Backend) *ControlSocket {
+	if path == "" {
+		path = DEFAULT_SOCKET
+	}
+	return &ControlSocket{path: path, backend: be}
+}
+
+// Start : listens on the socket and serves till the context is done, requests in flight are done before the wait group is
+// socket left behind by an earlier run that did not go down cleanly is removed
+func (cs *ControlSocket) Start(ctx context.Context, wg *sync.WaitGroup) error {
+	if fi, err := os.Lstat(cs.path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("failed to listen on %s: %w", cs.path, os.ErrExist)
+		}
+		os.Remove(cs.path)
+	}
+	ln, err := cs.listen()
+	if err != nil {
+		return err
+	}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		logrus.WithFields(logrus.Fields{"path": cs.path}).Info("control socket listening")
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					logrus.Errorf("control socket stopped: %s", err)
+				}
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				cs.serve(conn)
+			}()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		defer logrus.Warn("Now closing control socket..")
+		<-ctx.Done()
+		ln.Close()
+		os.Remove(cs.path)
+	}()
+	return nil
+}
+
+// listen : binds the socket in a private directory beside the path, and moves it in place once it has SOCKET_MODE
+// socket is never at the path with the mode the umask would give it, for others to connect in the meantime
+func (cs *ControlSocket) listen() (*net.UnixListener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(cs.path), ".patioctl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", cs.path, err)
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, filepath.Base(cs.path))
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", cs.path, err)
+	}
+	ln.SetUnlinkOnClose(false) // socket file is removed by its final path
+	if err := os.Chmod(tmp, SOCKET_MODE); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to set the mode of %s: %w", cs.path, err)
+	}
+	if err := os.Rename(tmp, cs.path); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to move the socket to %s: %w", cs.path, err)
+	}
+	return ln, nil
+}
+
+// serve : one request and its reply on the connection
+func (cs *ControlSocket) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(SOCKET_TIMEOUT))
+	req := ControlRequest{}
+	rep := ControlReply{}
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		rep.Error = fmt.Sprintf("invalid request: %s", err)
+	} else {
+		rep = cs.Handle(req)
+	}
+	if err := json.NewEncoder(conn).Encode(rep); err != nil {
+		logrus.Warnf("control socket reply failed: %s", err)
+	}
+}
+
+// Handle : runs the command and replies
+//
+//	status					: relays, upcoming switches, sensors and the status dump
+//	relay <name> [on|off|resume] [duration|clock]	: manual override of the relay
+//	schedule next				: upcoming switches
+//	reload					: reads the configuration file afresh
+//	loglevel [level]			: sets the logging level, or tells the one in force
+//	ack					: acknowledges the latched leak alarm
+func (cs *ControlSocket) Handle(req ControlRequest) ControlReply {
+	logrus.WithFields(logrus.Fields{"cmd": req.Cmd, "args": req.Args}).Debug("control socket request")
+	data, err := cs.handle(req)
+	if err != nil {
+		return ControlReply{Error: err.Error()}
+	}
+	return ControlReply{Data: data}
+}
+
+func (cs *ControlSocket) handle(req ControlRequest) (interface{}, error) {
+	switch req.Cmd {
+	case "status":
+		return map[string]interface{}{
+			"relays":  cs.backend.Relays(),
+			"next":    cs.backend.Next(),
+			"sensors": sensorStates(cs.backend.Sensors()),
+			"status":  cs.backend.Status(),
+		}, nil
+	case "relay":
+		if len(req.Args) == 0 {
+			return nil, fmt.Errorf("relay name missing, relay <name> [on|off|resume] [duration|clock]")
+		}
+		if err := cs.backend.Override(req.Args[0], req.Args[1:], ORIGIN_CLI); err != nil {
+			return nil, err
+		}
+		return cs.backend.Relays(), nil
+	case "schedule":
+		if len(req.Args) != 1 || req.Args[0] != "next" {
+			return nil, fmt.Errorf("%w: schedule %v, only schedule next", ErrUnknownCmd, req.Args)
+		}
+		return cs.backend.Next(), nil
+	case "reload":
+		if err := cs.backend.Reload(); err != nil {
+			return nil, err
+		}
+		return cs.backend.Config(), nil
+	case "loglevel":
+		if len(req.Args) > 0 {
+			lvl, err := logrus.ParseLevel(req.Args[0])
+			if err != nil {
+				return nil, err
+			}
+			logrus.SetLevel(lvl)
+			logrus.WithFields(logrus.Fields{"level": lvl}).Warn("logging level changed on the control socket")
+		}
+		return logrus.GetLevel().String(), nil
+	case "ack":
+		if err := cs.backend.Acknowledge(); err != nil {
+			return nil, err
+		}
+		return "alarm acknowledged", nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownCmd, req.Cmd)
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eensymachines-in/patio/aquacfg"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestControlHandle(t *testing.T) {
+	cfg := aquacfg.AppConfig{}
+	overrides := []string{}
+	cs := NewControlSocket("", testBackend(&cfg, &overrides))
+
+	rep := cs.Handle(ControlRequest{Cmd: "relay", Args: []string{"pump", "on", "10m"}})
+	assert.Empty(t, rep.Error)
+	assert.Equal(t, []string{"cli [on 10m]"}, overrides)
+	rep = cs.Handle(ControlRequest{Cmd: "relay", Args: []string{"drain", "on"}})
+	assert.Contains(t, rep.Error, ErrNoRelay.Error())
+	rep = cs.Handle(ControlRequest{Cmd: "relay"})
+	assert.NotEmpty(t, rep.Error, "relay name is required")
+
+	rep = cs.Handle(ControlRequest{Cmd: "schedule", Args: []string{"next"}})
+	assert.Len(t, rep.Data, 1)
+	rep = cs.Handle(ControlRequest{Cmd: "schedule", Args: []string{"last"}})
+	assert.Contains(t, rep.Error, ErrUnknownCmd.Error())
+
+	rep = cs.Handle(ControlRequest{Cmd: "status"})
+	assert.Empty(t, rep.Error)
+	assert.Contains(t, rep.Data, "relays")
+	assert.Contains(t, rep.Data, "sensors")
+
+	defer logrus.SetLevel(logrus.GetLevel())
+	rep = cs.Handle(ControlRequest{Cmd: "loglevel", Args: []string{"debug"}})
+	assert.Equal(t, "debug", rep.Data)
+	assert.Equal(t, logrus.DebugLevel, logrus.GetLevel())
+	rep = cs.Handle(ControlRequest{Cmd: "loglevel", Args: []string{"chatty"}})
+	assert.NotEmpty(t, rep.Error)
+
+	rep = cs.Handle(ControlRequest{Cmd: "ack"})
+	assert.Equal(t, ErrNoAlarm.Error(), rep.Error)
+
+	rep = cs.Handle(ControlRequest{Cmd: "reboot"})
+	assert.Contains(t, rep.Error, ErrUnknownCmd.Error())
+}
+
+func TestControlSocket(t *testing.T) {
+	cfg := aquacfg.AppConfig{AppName: "test"}
+	path := filepath.Join(t.TempDir(), "ctl.sock")
+	assert.Nil(t, os.WriteFile(path, nil, 0600), "stale regular file is not ours to remove")
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	cs := NewControlSocket(path, testBackend(&cfg, &[]string{}))
+	assert.NotNil(t, cs.Start(ctx, &wg))
+	assert.Nil(t, os.Remove(path))
+
+	assert.Nil(t, cs.Start(ctx, &wg))
+	fi, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(SOCKET_MODE), fi.Mode().Perm())
+
+	conn, err := net.Dial("unix", path)
+	assert.Nil(t, err)
+	assert.Nil(t, json.NewEncoder(conn).Encode(ControlRequest{Cmd: "reload"}))
+	rep := struct {
+		Data  aquacfg.AppConfig `json:"data"`
+		Error string            `json:"error"`
+	}{}
+	assert.Nil(t, json.NewDecoder(conn).Decode(&rep))
+	assert.Empty(t, rep.Error)
+	assert.Equal(t, "test", rep.Data.AppName)
+	conn.Close()
+
+	// request in flight when the context is done still gets its reply
+	conn, err = net.Dial("unix", path)
+	assert.Nil(t, err)
+	defer conn.Close()
+	var sent atomic.Bool
+	replied := make(chan ControlReply, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		sent.Store(true)
+		json.NewEncoder(conn).Encode(ControlRequest{Cmd: "ack"})
+		r := ControlReply{}
+		json.NewDecoder(conn).Decode(&r)
+		replied <- r
+	}()
+	time.Sleep(10 * time.Millisecond) // connection is accepted before the way down
+	cancel()
+	wg.Wait()
+	assert.True(t, sent.Load(), "shutdown did not wait for the request in flight")
+	select {
+	case r := <-replied:
+		assert.Equal(t, ErrNoAlarm.Error(), r.Error)
+	case <-time.After(time.Second):
+		t.Fatal("no reply for the request in flight")
+	}
+	_, err = os.Stat(path)
+	assert.True(t, errors.Is(err, os.ErrNotExist), "socket is removed on the way down")
+}
@@ -1,6 +1,9 @@
 package aquacfg
 
-import "regexp"
+import (
+	"math"
+	"regexp"
+)
 
 type ScheduleType uint8
 
@@ -13,6 +16,7 @@ const (
 	TICK_EVERY_DAYAT
 	PULSE_EVERY
 	PULSE_EVERY_DAYAT
+	SIPHON_SENSE // pump driven by the siphon state, falls back to pulse every interval
 )
 
 type Schedule struct {
@@ -29,6 +33,14 @@ func (sched *Schedule) IsValid() bool {
 		// interval cannot be so short - short intervals can lead to shortened life of the relays
 		return false
 	}
+	if sched.Config > SIPHON_SENSE {
+		// unknown schedule
+		return false
+	}
+	if sched.Config == SIPHON_SENSE && (sched.Interval <= INTERVAL_MIN || sched.PulseGap <= INTERVAL_MIN) {
+		// siphon sensing falls back to pulse every interval, same limits apply
+		return false
+	}
 	if (sched.Config == PULSE_EVERY || sched.Config == PULSE_EVERY_DAYAT) && sched.PulseGap <= INTERVAL_MIN {
 		// pulse gap cannot be less than a threshold since it would be then detrimental to the relay life
 		return false
@@ -47,10 +59,276 @@ func (sched *Schedule) IsValid() bool {
 	return true
 }
 
-// AppConfig : object model that captures the configuration for the app in a single run
-// configuration is loaded in the memory once in init, and then stays for the life of the appliation
-// Any change in the configuration has to be enforced my restarting the application
+// RelayConfig : protective limits for the relays, enforced by the relay driver itself
+// All durations are in seconds, zero values disable the limit
+type RelayConfig struct {
+	MinOn      int    `json:"minon,omitempty"`      // minimum seconds the relay stays closed before it can be opened
+	MinOff     int    `json:"minoff,omitempty"`     // minimum seconds the relay stays open before it can be closed
+	MaxPerHour int    `json:"maxperhour,omitempty"` // maximum switches in any 1 hour window
+	Queue      bool   `json:"queue,omitempty"`      // violating requests are deferred when true, else rejected
+	StateFile  string `json:"statefile,omitempty"`  // relay usage persists here across restarts
+	SafeOn     bool   `json:"safeon,omitempty"`     // relay is left closed when the service goes down, open by default
+}
+
+// IsValid : limits cannot be negative
+func (rc *RelayConfig) IsValid() bool {
+	return rc.MinOn >= 0 && rc.MinOff >= 0 && rc.MaxPerHour >= 0
+}
+
+// FlowConfig : pump speed levels for variable speed pumps, all values are percent of full speed
+// Applies only when the pump is PWM driven, on/off pumps ignore this
+type FlowConfig struct {
+	Flood   int `json:"flood,omitempty"`   // inflow till the growbed floods and the siphon locks
+	Drain   int `json:"drain,omitempty"`   // minimal inflow while the siphon drains the growbed
+	MinDuty int `json:"minduty,omitempty"` // motor stalls below this
+}
+
+// IsValid : levels are percentages, and drain inflow cannot be more than the flood inflow
+func (fc *FlowConfig) IsValid() bool {
+	for _, v := range []int{fc.Flood, fc.Drain, fc.MinDuty} {
+		if v < 0 || v > 100 {
+			return false
+		}
+	}
+	return fc.Flood == 0 || fc.Drain <= fc.Flood
+}
+
+// FlowMeterConfig : water flow sensor on the siphon outlet
+type FlowMeterConfig struct {
+	KFactor float64 `json:"kfactor,omitempty"` // pulses per litre, defaults to 450 for YF-S201
+}
+
+// SiphonConfig : timings for the siphon sensing schedule, all in seconds
+// Zero timeouts are disabled, though its best to have them
+type SiphonConfig struct {
+	Threshold    float64 `json:"threshold,omitempty"`    // drain flow L/min above which the siphon is locked, default 0.5
+	ResumeDelay  int     `json:"resumedelay,omitempty"`  // pump resumes this long after the lock breaks
+	FloodTimeout int     `json:"floodtimeout,omitempty"` // siphon not locking this long after the pump starts falls back to timed
+	DrainTimeout int     `json:"draintimeout,omitempty"` // lock not breaking this long after it locked falls back to timed
+	Stale        int     `json:"stale,omitempty"`        // no readings from the sensor this long falls back to timed, default 30
+}
+
+// IsValid : none of the values can be negative
+func (sc *SiphonConfig) IsValid() bool {
+	return sc.Threshold >= 0 && sc.ResumeDelay >= 0 && sc.FloodTimeout >= 0 && sc.DrainTimeout >= 0 && sc.Stale >= 0
+}
+
+// TemperatureConfig : water temperature probes on the 1-Wire bus
+// Min & Max are the alarm range for the water temperature, both zero disables the alarm
+type TemperatureConfig struct {
+	Root     string       `json:"root,omitempty"`     // root of the w1 sysfs tree, defaults to /sys/bus/w1/devices
+	Interval int          `json:"interval,omitempty"` // seconds between readings, default 60
+	Min      float64      `json:"min,omitempty"`      // water colder than this raises a sensor fault
+	Max      float64      `json:"max,omitempty"`      // water warmer than this raises a sensor fault
+	Filter   FilterConfig `json:"filter,omitempty"`
+}
+
+// IsValid : interval cannot be negative, and range if specified has to be a range
+func (tc *TemperatureConfig) IsValid() bool {
+	return tc.Interval >= 0 && (tc.Min == 0 && tc.Max == 0 || tc.Min < tc.Max) && tc.Filter.IsValid()
+}
+
+// PHPoint : probe voltage in a buffer solution of known pH
+type PHPoint struct {
+	PH    float64 `json:"ph"`
+	Volts float64 `json:"volts"`
+}
+
+// PHConfig : pH probe on the ADS1115 ADC, probe is enabled only when calibrated
+// Min & Max are the alarm range for the water pH, both zero disables the alarm
+type PHConfig struct {
+	Address     int          `json:"address,omitempty"`     // I2C address of the ADC, default 0x48
+	Channel     int          `json:"channel,omitempty"`     // ADC channel the probe is on, 0-3
+	Gain        *int         `json:"gain,omitempty"`        // ADC gain index 0-5 : 6.144V, 4.096V, 2.048V, 1.024V, 0.512V, 0.256V. default 1 when left out, 0 is a valid gain
+	Calibration []PHPoint    `json:"calibration,omitempty"` // 2 or 3 buffer points
+	CalTemp     float64      `json:"caltemp,omitempty"`     // buffer temperature at calibration, default 25
+	Samples     int          `json:"samples,omitempty"`     // median of these many samples, default 9
+	Interval    int          `json:"interval,omitempty"`    // seconds between readings, default 60
+	Min         float64      `json:"min,omitempty"`         // pH lower than this raises a sensor fault
+	Max         float64      `json:"max,omitempty"`         // pH higher than this raises a sensor fault
+	Filter      FilterConfig `json:"filter,omitempty"`
+}
+
+// IsValid : calibration if any has to have 2 or 3 points, and the rest within the limits of the hardware
+func (pc *PHConfig) IsValid() bool {
+	if len(pc.Calibration) == 1 || len(pc.Calibration) > 3 {
+		return false
+	}
+	if pc.Channel < 0 || pc.Channel > 3 || pc.Samples < 0 || pc.Interval < 0 {
+		return false
+	}
+	if pc.Gain != nil && (*pc.Gain < 0 || *pc.Gain > 5) {
+		return false
+	}
+	return (pc.Min == 0 && pc.Max == 0 || pc.Min < pc.Max) && pc.Filter.IsValid()
+}
+
+// Tank shapes
+const (
+	TANK_RECT     = "rect"
+	TANK_CYLINDER = "cylinder"
+)
+
+// TankConfig : geometry of the fish tank, converts the water level to litres. All dimensions in cm
+// Leak alarms are raised on loss beyond the expected evaporation, either sudden or sustained
+type TankConfig struct {
+	Shape        string       `json:"shape,omitempty"`        // rect or cylinder
+	Length       float64      `json:"length,omitempty"`       // rect only
+	Width        float64      `json:"width,omitempty"`        // rect only
+	Diameter     float64      `json:"diameter,omitempty"`     // cylinder only
+	Height       float64      `json:"height,omitempty"`       // inner height of the tank
+	SensorHeight float64      `json:"sensorheight,omitempty"` // ultrasonic sensor face above the tank floor
+	Evaporation  float64      `json:"evaporation,omitempty"`  // litres lost to evaporation in a day
+	CycleLitres  float64      `json:"cyclelitres,omitempty"`  // litres the flood cycle holds up in the growbed at most
+	SuddenLitres float64      `json:"suddenlitres,omitempty"` // loss beyond the cycle within SuddenMins is a leak, default 10
+	SuddenMins   int          `json:"suddenmins,omitempty"`   // default 15
+	SustainHours int          `json:"sustainhours,omitempty"` // loss beyond evaporation over these many hours is a leak, default 6
+	Tolerance    float64      `json:"tolerance,omitempty"`    // litres of slack for the sustained loss, default 5
+	DryLitres    float64      `json:"drylitres,omitempty"`    // pump is blocked below this volume, 0 disables
+	ReleaseAt    float64      `json:"releaseat,omitempty"`    // pump block releases above this volume, atleast DryLitres
+	Filter       FilterConfig `json:"filter,omitempty"`
+}
+
+// IsValid : tank if specified has to have a known shape & dimensions
+func (tc *TankConfig) IsValid() bool {
+	switch tc.Shape {
+	case "":
+		return true
+	case TANK_RECT:
+		if tc.Length <= 0 || tc.Width <= 0 {
+			return false
+		}
+	case TANK_CYLINDER:
+		if tc.Diameter <= 0 {
+			return false
+		}
+	default:
+		return false
+	}
+	return tc.Height > 0 && tc.SensorHeight >= tc.Height && tc.Evaporation >= 0 && tc.CycleLitres >= 0 &&
+		tc.SuddenLitres >= 0 && tc.SuddenMins >= 0 && tc.SustainHours >= 0 && tc.Tolerance >= 0 &&
+		tc.DryLitres >= 0 && (tc.ReleaseAt == 0 || tc.ReleaseAt >= tc.DryLitres) && tc.Filter.IsValid()
+}
+
+// Area : water surface area in sq cm
+func (tc *TankConfig) Area() float64 {
+	if tc.Shape == TANK_CYLINDER {
+		return math.Pi * tc.Diameter * tc.Diameter / 4
+	}
+	return tc.Length * tc.Width
+}
+
+// Litres : volume of water in the tank for the water level in cm, clamped to the tank height
+func (tc *TankConfig) Litres(level float64) float64 {
+	level = math.Max(0, math.Min(level, tc.Height))
+	return tc.Area() * level / 1000
+}
+
+// Level : water level in cm for the distance to the water surface from the ultrasonic sensor
+func (tc *TankConfig) Level(distance float64) float64 {
+	return tc.SensorHeight - distance
+}
+
+// Capacity : litres when the tank is full
+func (tc *TankConfig) Capacity() float64 {
+	return tc.Litres(tc.Height)
+}
+
+// WatchdogConfig : hardware watchdog that reboots the board when any of the loops hangs
+type WatchdogConfig struct {
+	Device   string `json:"device,omitempty"`   // defaults to /dev/watchdog
+	Disabled bool   `json:"disabled,omitempty"` // true on the bench, where a reboot is not wanted
+	Stall    int    `json:"stall,omitempty"`    // seconds a loop can go without a heartbeat before it is taken as hung, default 60
+}
+
+// IsValid : stall cannot be negative
+func (wc *WatchdogConfig) IsValid() bool {
+	return wc.Stall >= 0
+}
+
+// Filters that smooth the sensor readings
+const (
+	FILTER_NONE        = ""
+	FILTER_AVERAGE     = "average"     // moving average of the last Window readings
+	FILTER_MEDIAN      = "median"      // median of the last Window readings, rejects spikes
+	FILTER_EXPONENTIAL = "exponential" // exponentially weighted, Alpha is the weight of the latest reading
+)
+
+// FilterConfig : smoothing of the readings from a sensor
+type FilterConfig struct {
+	Kind   string  `json:"kind,omitempty"`
+	Window int     `json:"window,omitempty"` // average & median only, default 5
+	Alpha  float64 `json:"alpha,omitempty"`  // exponential only, 0-1 default 0.3
+}
+
+// IsValid : filter has to be of known kind, with window & alpha within limits
+func (fc *FilterConfig) IsValid() bool {
+	switch fc.Kind {
+	case FILTER_NONE, FILTER_AVERAGE, FILTER_MEDIAN, FILTER_EXPONENTIAL:
+	default:
+		return false
+	}
+	return fc.Window >= 0 && fc.Alpha >= 0 && fc.Alpha <= 1
+}
+
+// Actions that can be mapped to touch gestures
+const (
+	ACTION_NONE     = "none"     // gesture is ignored
+	ACTION_OVERRIDE = "override" // manual pump override
+	ACTION_SHUTDOWN = "shutdown" // clean shutdown of the application
+	ACTION_NEXTPAGE = "nextpage" // cycles the pages on the OLED
+)
+
+// TouchConfig : maps touch sensor gestures to actions
+// Empty values fall back to the defaults : tap = override, hold = shutdown, double tap = nextpage
+type TouchConfig struct {
+	Tap      string `json:"tap,omitempty"`      // action for a single short touch
+	Hold     string `json:"hold,omitempty"`     // action for a touch held atleast HoldSecs
+	Double   string `json:"double,omitempty"`   // action for 2 quick touches
+	HoldSecs int    `json:"holdsecs,omitempty"` // seconds of touch to count as hold, default 3
+}
+
+// Actions : gesture to action mapping with the defaults filled in
+func (tc *TouchConfig) Actions() (tap, hold, double string) {
+	pick := func(val, def string) string {
+		if val == "" {
+			return def
+		}
+		return val
+	}
+	return pick(tc.Tap, ACTION_OVERRIDE), pick(tc.Hold, ACTION_SHUTDOWN), pick(tc.Double, ACTION_NEXTPAGE)
+}
+
+// IsValid : all the gestures have to be mapped to known actions
+func (tc *TouchConfig) IsValid() bool {
+	tap, hold, double := tc.Actions()
+	for _, act := range []string{tap, hold, double} {
+		if act != ACTION_NONE && act != ACTION_OVERRIDE && act != ACTION_SHUTDOWN && act != ACTION_NEXTPAGE {
+			return false
+		}
+	}
+	return tc.HoldSecs >= 0
+}
+
+// AppConfig : object model that captures the configuration for the app
+// configuration is loaded at start and again on every reload (SIGHUP), a configuration that is not valid is rejected and the running one stays
+// pins, probes, tank, filters & touch timings are taken at start only, changes to those need a restart
 type AppConfig struct {
-	AppName  string   `json:"appname"`
-	Schedule Schedule `json:"schedule"`
+	AppName   string            `json:"appname"`
+	Schedule  Schedule          `json:"schedule"`
+	Relay     RelayConfig       `json:"relay"`
+	Touch     TouchConfig       `json:"touch"`
+	Flow      FlowConfig        `json:"flow"`
+	FlowMeter FlowMeterConfig   `json:"flowmeter"`
+	Siphon    SiphonConfig      `json:"siphon"`
+	Temp      TemperatureConfig `json:"temperature"`
+	PH        PHConfig          `json:"ph"`
+	Tank      TankConfig        `json:"tank"`
+	Watchdog  WatchdogConfig    `json:"watchdog"`
+}
+
+// IsValid : all the sections have to be valid, for the application to schedule the pump
+func (ac *AppConfig) IsValid() bool {
+	return ac.Schedule.IsValid() && ac.Relay.IsValid() && ac.Touch.IsValid() && ac.Flow.IsValid() && ac.Siphon.IsValid() &&
+		ac.Temp.IsValid() && ac.PH.IsValid() && ac.Tank.IsValid() && ac.Watchdog.IsValid()
 }
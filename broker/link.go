@@ -0,0 +1,130 @@
+package broker
+
+/* ====================
+Connection to the AMQP broker that the device uses for configuration alerts & remote commands.
+Link keeps the connection alive - it redials when the broker drops it - and publishes the connection state so that the rest of the application (ErrLED for one) can tell when the broker is unreachable.
+==================== */
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	REDIAL_INTERVAL = 30 * time.Second // time between attempts to reconnect to the broker
+)
+
+// conn : what the link needs of the amqp connection
+type conn interface {
+	Channel() (*amqp.Channel, error)
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+// Link : self healing connection to the broker
+type Link struct {
+	url  string
+	mu   sync.Mutex
+	conn conn
+	err  error // reason the link is down, nil when connected
+	dial func(url string) (conn, error)
+}
+
+// NewLink : ctor for the link, does not connect till Watch
+// server	: host:port of the broker
+// login	: user:password for the broker
+//
+/*
+	link := broker.NewLink(os.Getenv("AMQP_SERVER"), os.Getenv("AMQP_LOGIN"))
+	for up := range link.Watch(broker.REDIAL_INTERVAL, ctx, &wg) {
+		log.Debugf("broker connected: %t", up)
+	}
+*/
+func NewLink(server, login string) *Link {
+	return &Link{
+		url: fmt.Sprintf("amqp://%s@%s/", login, server),
+		err: fmt.Errorf("broker not yet connected"),
+		dial: func(url string) (conn, error) {
+			return amqp.Dial(url)
+		},
+	}
+}
+
+// Connected : true when the link is up
+func (l *Link) Connected() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err == nil
+}
+
+// Err : reason the link is down, nil when connected
+func (l *Link) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Channel : opens a new channel on the connection
+func (l *Link) Channel() (*amqp.Channel, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return nil, l.err
+	}
+	return l.conn.Channel()
+}
+
+// Watch : dials the broker and redials every interval when the connection drops
+// sends the connection state every time it changes, connection is closed & channel closed when the context is done
+func (l *Link) Watch(interval time.Duration, ctx context.Context, wg *sync.WaitGroup) chan bool {
+	states := make(chan bool, 1)
+	send := func(up bool) {
+		select {
+		case <-states: // only the latest state matters
+		default:
+		}
+		states <- up
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(states)
+		defer logrus.Warn("Now closing broker link..")
+		for {
+			conn, err := l.dial(l.url)
+			if err != nil {
+				l.mu.Lock()
+				l.err = fmt.Errorf("failed to dial broker: %w", err)
+				l.mu.Unlock()
+				send(false)
+				select {
+				case <-time.After(interval):
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+			closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+			l.mu.Lock()
+			l.conn, l.err = conn, nil
+			l.mu.Unlock()
+			logrus.Info("connected to broker")
+			send(true)
+			select {
+			case amqpErr := <-closed:
+				l.mu.Lock()
+				l.err = fmt.Errorf("broker connection closed: %v", amqpErr)
+				l.mu.Unlock()
+				send(false)
+			case <-ctx.Done():
+				conn.Close()
+				return
+			}
+		}
+	}()
+	return states
+}
@@ -0,0 +1,63 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeConn : connection that the test can drop
+type fakeConn struct {
+	closed chan *amqp.Error
+}
+
+func (fc *fakeConn) Channel() (*amqp.Channel, error) { return nil, errors.New("no channels on a fake") }
+func (fc *fakeConn) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	fc.closed = receiver
+	return receiver
+}
+func (fc *fakeConn) Close() error { return nil }
+
+func TestLinkRedial(t *testing.T) {
+	l := NewLink("localhost:5672", "guest:guest")
+	dials := make(chan error)        // outcome of each dial, as the test has it
+	conns := make(chan *fakeConn, 1) // connections the dials made
+	l.dial = func(url string) (conn, error) {
+		if err := <-dials; err != nil {
+			return nil, err
+		}
+		fc := &fakeConn{}
+		conns <- fc
+		return fc, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	states := l.Watch(10*time.Millisecond, ctx, &wg)
+
+	dials <- errors.New("connection refused")
+	assert.False(t, <-states, "broker refused")
+	assert.False(t, l.Connected())
+	assert.Contains(t, l.Err().Error(), "failed to dial broker")
+
+	dials <- nil // redialed after the interval
+	fc := <-conns
+	assert.True(t, <-states)
+	assert.True(t, l.Connected())
+
+	fc.closed <- &amqp.Error{Code: 320, Reason: "CONNECTION_FORCED"}
+	assert.False(t, <-states, "broker dropped the connection")
+	assert.Contains(t, l.Err().Error(), "broker connection closed")
+	dials <- nil // redialed right away
+	<-conns
+	assert.True(t, <-states)
+
+	cancel()
+	wg.Wait()
+	_, open := <-states
+	assert.False(t, open, "states are closed once done")
+}
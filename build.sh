@@ -4,6 +4,7 @@ echo "Now building and installing aquaponic control program.. "
 
 sudo ln -sf /home/niranjan/source/github.com/eensymachines-in/aquapone/aquapone.config.json /etc/aquapone.config.json
 sudo go build -o /usr/bin/eensymacaqupone .  && sudo chmod 774 /usr/bin/eensymacaqupone
+sudo go build -o /usr/bin/patioctl ./cmd/patioctl && sudo chmod 775 /usr/bin/patioctl
 
 echo 'building systemctl unit..'
 sudo systemctl enable $(pwd)/$NAME_SYSCTLSERVICE
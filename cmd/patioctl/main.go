@@ -0,0 +1,206 @@
+package main
+
+/* ===========
+patioctl : talks to the aquaponics pump controller over its control socket, from a shell on the box
+
+	patioctl status
+	patioctl relay pump on --for 10m
+	patioctl relay pump off --until 15:30
+	patioctl relay pump resume
+	patioctl schedule next
+	patioctl reload
+	patioctl loglevel debug
+	patioctl ack
+
+Socket is at /run/aquapone/patioctl.sock unless -socket or PATH_CTLSOCK say otherwise, and only the owner & group of the service can connect.
+=============== */
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eensymachines-in/patio/api"
+)
+
+const usage = `usage: patioctl [-socket path] [-json] <command>
+	status					relays, upcoming switches, sensors & faults
+	relay <name> [on|off|resume] [--for 10m|--until 15:30]	manual override, flips the relay when the state is left out
+	schedule next				upcoming switches
+	reload					reads the configuration file afresh
+	loglevel [level]			sets the logging level of the service, or tells the one in force
+	ack					acknowledges the leak alarm, once the tank is seen to
+`
+
+func main() {
+	socket := os.Getenv("PATH_CTLSOCK")
+	if socket == "" {
+		socket = api.DEFAULT_SOCKET
+	}
+	flag.StringVar(&socket, "socket", socket, "path of the control socket")
+	raw := flag.Bool("json", false, "prints the reply as json as it is")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	req, err := request(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	data, err := send(socket, req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "patioctl: %s\n", err)
+		os.Exit(1)
+	}
+	if *raw {
+		fmt.Println(string(data))
+		return
+	}
+	if err := printReply(req.Cmd, data); err != nil {
+		fmt.Fprintf(os.Stderr, "patioctl: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// request : command line to the control request, --for & --until become the plain args the service expects
+func request(args []string) (api.ControlRequest, error) {
+	req := api.ControlRequest{Cmd: args[0]}
+	for i := 1; i < len(args); i++ {
+		switch a := strings.TrimLeft(args[i], "-"); {
+		case a == "for" || a == "until":
+			if i+1 >= len(args) {
+				return req, fmt.Errorf("--%s needs a value", a)
+			}
+			i++
+			req.Args = append(req.Args, args[i])
+		case strings.HasPrefix(a, "for=") || strings.HasPrefix(a, "until="):
+			req.Args = append(req.Args, a[strings.Index(a, "=")+1:])
+		default:
+			req.Args = append(req.Args, args[i])
+		}
+	}
+	return req, nil
+}
+
+// send : sends the request on the socket and reads the reply, data of the reply as it is
+func send(socket string, req api.ControlRequest) (json.RawMessage, error) {
+	conn, err := net.DialTimeout("unix", socket, api.SOCKET_TIMEOUT)
+	if err != nil {
+		return nil, fmt.Errorf("service not reachable on %s: %w", socket, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(api.SOCKET_TIMEOUT))
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	rep := struct {
+		Data  json.RawMessage `json:"data"`
+		Error string          `json:"error"`
+	}{}
+	if err := json.NewDecoder(conn).Decode(&rep); err != nil {
+		return nil, fmt.Errorf("invalid reply: %w", err)
+	}
+	if rep.Error != "" {
+		return nil, fmt.Errorf("%s", rep.Error)
+	}
+	return rep.Data, nil
+}
+
+// printReply : reply in a form for the eyes
+func printReply(cmd string, data json.RawMessage) error {
+	switch cmd {
+	case "status":
+		st := struct {
+			Relays  []api.RelayState       `json:"relays"`
+			Next    []api.Transition       `json:"next"`
+			Sensors []api.SensorState      `json:"sensors"`
+			Status  map[string]interface{} `json:"status"`
+		}{}
+		if err := json.Unmarshal(data, &st); err != nil {
+			return err
+		}
+		printRelays(st.Relays)
+		printNext(st.Next)
+		for _, s := range st.Sensors {
+			if s.Value == nil {
+				fmt.Printf("%-8s --\t%s\n", s.ID, s.Err)
+				continue
+			}
+			fmt.Printf("%-8s %.2f%s\tat %s\n", s.ID, *s.Value, s.Unit, s.At.Format("15:04:05"))
+		}
+		keys := []string{}
+		for k := range st.Status {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Printf("%-16s %v\n", k, st.Status[k])
+		}
+	case "relay":
+		relays := []api.RelayState{}
+		if err := json.Unmarshal(data, &relays); err != nil {
+			return err
+		}
+		printRelays(relays)
+	case "schedule":
+		next := []api.Transition{}
+		if err := json.Unmarshal(data, &next); err != nil {
+			return err
+		}
+		printNext(next)
+	case "reload":
+		fmt.Println("configuration reloaded")
+	default:
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		fmt.Println(v)
+	}
+	return nil
+}
+
+func onOff(on bool) string {
+	if on {
+		return "ON"
+	}
+	return "OFF"
+}
+
+// stamp : time for the eyes, -- when there is none
+func stamp(t *time.Time) string {
+	if t == nil {
+		return "--"
+	}
+	return t.Format("Jan-02 15:04:05")
+}
+
+func printRelays(relays []api.RelayState) {
+	for _, r := range relays {
+		line := fmt.Sprintf("%-8s %-4s by %s: %s", r.Name, onOff(r.On), r.Source, r.Reason)
+		if r.Until != nil {
+			line = fmt.Sprintf("%s, till %s (%s left)", line, r.Until.Format("15:04:05"), time.Until(*r.Until).Round(time.Second))
+		}
+		if r.Err != "" {
+			line = fmt.Sprintf("%s, not switched: %s", line, r.Err)
+		}
+		fmt.Printf("%s\n\t%.1fh on, %d switches, last on %s, last off %s\n", line, r.Hours, r.Switches, stamp(r.LastOn), stamp(r.LastOff))
+	}
+}
+
+func printNext(next []api.Transition) {
+	if len(next) == 0 {
+		fmt.Println("no switches scheduled")
+	}
+	for _, t := range next {
+		fmt.Printf("%s  %-8s %-4s by %s\n", t.At.Format("Jan-02 15:04:05"), t.Relay, onOff(t.On), t.Source)
+	}
+}
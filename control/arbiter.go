@@ -0,0 +1,332 @@
+package control
+
+/* ====================
+Several things want to drive the pump : the schedule, manual override, remote commands, rules and the safety interlocks.
+Arbiter sits in front of the relay and takes requests from each of these sources, the relay is then switched as the highest priority request has it
+
+	safety > manual > remote > rules > schedule
+
+Requests stay till the source releases them or till they expire, so a lower priority source gets the relay back as soon as the one above is done.
+Arbiter records the source and the reason for every decision - why the relay is in the state it is, is never a guess.
+Interlocks on the relay itself (guards, dwell limits) still have their say, arbiter only decides what is asked of the relay.
+==================== */
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Source : who requests the relay state, higher the source higher the priority
+type Source uint8
+
+const (
+	SRC_NONE     Source = iota // no requests, relay is kept open
+	SRC_SCHEDULE               // the pump schedule
+	SRC_RULES                  // rules on the sensor readings
+	SRC_REMOTE                 // remote commands over the broker
+	SRC_MANUAL                 // hands on the device : touch, button, cli
+	SRC_SAFETY                 // interlocks like the dry run protection
+)
+
+const (
+	ARBITER_RETRY   = 30 * time.Second // relay that is out of step with the decision is switched again this often
+	ARBITER_HISTORY = 20               // decisions remembered
+)
+
+var (
+	ErrOverruled = errors.New("request overruled")
+)
+
+func (src Source) String() string {
+	switch src {
+	case SRC_NONE:
+		return "none"
+	case SRC_SCHEDULE:
+		return "schedule"
+	case SRC_RULES:
+		return "rules"
+	case SRC_REMOTE:
+		return "remote"
+	case SRC_MANUAL:
+		return "manual"
+	case SRC_SAFETY:
+		return "safety"
+	}
+	return "unknown"
+}
+
+// Relay : what the arbiter switches, digital.RelaySwitch is one
+type Relay interface {
+	Name() string
+	IsHigh() bool
+	High() error
+	Low() error
+}
+
+// Request : relay state as requested by one source
+type Request struct {
+	Source Source
+	On     bool
+	Until  time.Time // request expires at this time, zero when it stays till released
+	Reason string
+	At     time.Time
+}
+
+// active : false once the request has expired
+func (req Request) active(now time.Time) bool {
+	return req.Until.IsZero() || now.Before(req.Until)
+}
+
+// Decision : effective state of the relay and why
+type Decision struct {
+	Relay  string
+	Source Source // source whose request won, SRC_NONE when there are no requests
+	On     bool
+	Until  time.Time // decision holds till, zero when it holds till the source releases it
+	Reason string
+	At     time.Time
+	Err    error // relay did not switch as decided
+}
+
+// Remaining : time left for the decision to expire, zero when it does not expire
+func (d Decision) Remaining(now time.Time) time.Duration {
+	if d.Until.IsZero() || now.After(d.Until) {
+		return 0
+	}
+	return d.Until.Sub(now)
+}
+
+// Arbiter : decides the relay state from the requests of all the sources
+type Arbiter struct {
+	mu       sync.Mutex
+	relay    Relay
+	requests map[Source]Request
+	decision Decision
+	history  []Decision
+	change   chan bool // wakes up the watch when the decision or the deadlines change
+	now      func() time.Time
+	beat     func()        // relay & arbiter are alive, nil when not supervised
+	every    time.Duration // watch beats atleast this often
+}
+
+// NewArbiter : ctor for the arbiter in front of the relay
+// relay is not switched till the first request
+//
+/*
+	arb := control.NewArbiter(rs)
+	arb.Request(control.SRC_SCHEDULE, true, time.Time{}, "pulse every 10m")
+	arb.Request(control.SRC_MANUAL, false, time.Now().Add(10*time.Minute), "maintenance")
+	// relay is open for 10 minutes, and then back on schedule
+	for d := range arb.Watch(ctx, &wg) {
+		log.Infof("%s is %t by %s: %s", d.Relay, d.On, d.Source, d.Reason)
+	}
+*/
+func NewArbiter(relay Relay) *Arbiter {
+	return &Arbiter{
+		relay:    relay,
+		requests: map[Source]Request{},
+		decision: Decision{Relay: relay.Name(), Reason: "no requests"},
+		change:   make(chan bool, 1),
+		now:      time.Now,
+	}
+}
+
+// WithBeat : supervises the arbiter & the relay behind it, call before Watch
+// beat is called on every switch that goes through, and from the watch every interval once it has got hold of the arbiter and read the relay
+// arbiter or relay that hangs stops the beats
+//
+/*
+	relayBeat := sup.Register("relay", watchdog.DEFAULT_STALL)
+	arb := control.NewArbiter(rs).WithBeat(watchdog.HEARTBEAT, relayBeat.Beat)
+*/
+func (a *Arbiter) WithBeat(every time.Duration, beat func()) *Arbiter {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.beat, a.every = beat, every
+	return a
+}
+
+// Request : sets the relay state requested by the source, replacing its earlier request
+// until is when the request expires, zero for till released
+// error when the source is overruled by a higher one (ErrOverruled) or the relay did not switch
+func (a *Arbiter) Request(src Source, on bool, until time.Time, reason string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requests[src] = Request{Source: src, On: on, Until: until, Reason: reason, At: a.now()}
+	dec := a.decide()
+	if dec.Source != src {
+		return fmt.Errorf("%w by %s: %s", ErrOverruled, dec.Source, dec.Reason)
+	}
+	return dec.Err
+}
+
+// Release : drops the request of the source, false when there was none
+// relay goes to the state the next highest source has it in
+func (a *Arbiter) Release(src Source, reason string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.requests[src]; !ok {
+		return false
+	}
+	delete(a.requests, src)
+	logrus.WithFields(logrus.Fields{
+		"relay":  a.relay.Name(),
+		"source": src,
+	}).Debugf("request released: %s", reason)
+	a.decide()
+	return true
+}
+
+// Requested : the standing request of the source if any
+func (a *Arbiter) Requested(src Source) (Request, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	req, ok := a.requests[src]
+	if ok && !req.active(a.now()) {
+		return Request{}, false
+	}
+	return req, ok
+}
+
+// Requests : all the standing requests, highest priority first
+func (a *Arbiter) Requests() []Request {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	reqs := []Request{}
+	for _, req := range a.requests {
+		if req.active(now) {
+			reqs = append(reqs, req)
+		}
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].Source > reqs[j].Source })
+	return reqs
+}
+
+// Decision : current decision on the relay
+func (a *Arbiter) Decision() Decision {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.decision
+}
+
+// History : recent decisions, oldest first
+func (a *Arbiter) History() []Decision {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]Decision{}, a.history...)
+}
+
+// decide : picks the highest active request and switches the relay to it
+// call with the lock held
+func (a *Arbiter) decide() Decision {
+	now := a.now()
+	win := Request{Source: SRC_NONE, Reason: "no requests", At: now}
+	for src, req := range a.requests {
+		if !req.active(now) {
+			delete(a.requests, src) // expired
+			continue
+		}
+		if req.Source > win.Source {
+			win = req
+		}
+	}
+	prev := a.decision
+	dec := Decision{Relay: a.relay.Name(), Source: win.Source, On: win.On, Until: win.Until, Reason: win.Reason, At: now}
+	if dec.On {
+		dec.Err = a.relay.High()
+	} else {
+		dec.Err = a.relay.Low()
+	}
+	if dec.Err == nil && a.beat != nil {
+		a.beat()
+	}
+	if dec.Source == prev.Source && dec.On == prev.On && dec.Until.Equal(prev.Until) && dec.Reason == prev.Reason {
+		dec.At = prev.At // same decision, only the relay was switched again
+		a.decision = dec
+		return dec
+	}
+	a.decision = dec
+	a.history = append(a.history, dec)
+	if len(a.history) > ARBITER_HISTORY {
+		a.history = a.history[len(a.history)-ARBITER_HISTORY:]
+	}
+	select {
+	case a.change <- true:
+	default: // watch has a wake up pending already
+	}
+	return dec
+}
+
+// nextExpiry : earliest time a request expires, zero when none do
+// call with the lock held
+func (a *Arbiter) nextExpiry() time.Time {
+	next := time.Time{}
+	for _, req := range a.requests {
+		if !req.Until.IsZero() && (next.IsZero() || req.Until.Before(next)) {
+			next = req.Until
+		}
+	}
+	return next
+}
+
+// Watch : expires the requests on time and sends out every new decision, channel closes when the context is done
+// relay that is out of step with the decision, say a switch that was rejected for the dwell limits, is switched again every ARBITER_RETRY
+func (a *Arbiter) Watch(ctx context.Context, wg *sync.WaitGroup) chan Decision {
+	decisions := make(chan Decision, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(decisions)
+		defer logrus.Warn("Now closing relay arbiter..")
+		retry := time.NewTicker(ARBITER_RETRY)
+		defer retry.Stop()
+		var beats <-chan time.Time // nil when not supervised
+		a.mu.Lock()
+		if a.beat != nil && a.every > 0 {
+			tick := time.NewTicker(a.every)
+			defer tick.Stop()
+			beats = tick.C
+		}
+		a.mu.Unlock()
+		for {
+			var expiry <-chan time.Time
+			a.mu.Lock()
+			if next := a.nextExpiry(); !next.IsZero() {
+				expiry = time.After(next.Sub(a.now()))
+			}
+			a.mu.Unlock()
+			select {
+			case <-a.change:
+				select {
+				case <-decisions: // listener is lagging, only the latest decision matters
+				default:
+				}
+				decisions <- a.Decision()
+			case <-expiry:
+				a.mu.Lock()
+				a.decide()
+				a.mu.Unlock()
+			case <-retry.C:
+				a.mu.Lock()
+				if a.decision.Source != SRC_NONE && a.relay.IsHigh() != a.decision.On {
+					a.decide()
+				}
+				a.mu.Unlock()
+			case <-beats:
+				a.mu.Lock()
+				a.relay.IsHigh() // relay lock has to be had too
+				a.beat()
+				a.mu.Unlock()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return decisions
+}
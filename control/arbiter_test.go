@@ -0,0 +1,158 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRelay : relay that can be made to reject switching on
+type fakeRelay struct {
+	mu     sync.Mutex
+	on     bool
+	reject error
+}
+
+func (fr *fakeRelay) Name() string { return "pump" }
+
+func (fr *fakeRelay) IsHigh() bool {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	return fr.on
+}
+
+func (fr *fakeRelay) High() error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	if fr.reject != nil {
+		return fr.reject
+	}
+	fr.on = true
+	return nil
+}
+
+func (fr *fakeRelay) Low() error {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fr.on = false
+	return nil
+}
+
+func TestArbiterPriority(t *testing.T) {
+	relay := &fakeRelay{}
+	arb := NewArbiter(relay)
+	assert.Nil(t, arb.Request(SRC_SCHEDULE, true, time.Time{}, "pulse"))
+	assert.True(t, relay.IsHigh())
+
+	assert.Nil(t, arb.Request(SRC_MANUAL, false, time.Time{}, "maintenance"))
+	assert.False(t, relay.IsHigh(), "manual is above the schedule")
+	err := arb.Request(SRC_SCHEDULE, true, time.Time{}, "pulse")
+	assert.True(t, errors.Is(err, ErrOverruled), "schedule is held while overridden")
+	assert.False(t, relay.IsHigh())
+
+	assert.Nil(t, arb.Request(SRC_SAFETY, false, time.Time{}, "dry run"))
+	err = arb.Request(SRC_MANUAL, true, time.Time{}, "maintenance")
+	assert.True(t, errors.Is(err, ErrOverruled), "nothing gets past safety")
+	assert.False(t, relay.IsHigh())
+	dec := arb.Decision()
+	assert.Equal(t, SRC_SAFETY, dec.Source)
+	assert.Equal(t, "dry run", dec.Reason)
+
+	assert.True(t, arb.Release(SRC_SAFETY, "water recovered"))
+	assert.True(t, relay.IsHigh(), "manual has the relay back")
+	assert.True(t, arb.Release(SRC_MANUAL, "done"))
+	assert.False(t, arb.Release(SRC_MANUAL, "done"), "nothing to release")
+	assert.Equal(t, SRC_SCHEDULE, arb.Decision().Source)
+	assert.Equal(t, []Source{SRC_SCHEDULE}, func() []Source {
+		srcs := []Source{}
+		for _, req := range arb.Requests() {
+			srcs = append(srcs, req.Source)
+		}
+		return srcs
+	}())
+
+	assert.True(t, arb.Release(SRC_SCHEDULE, "stopped"))
+	assert.False(t, relay.IsHigh(), "relay opens with no requests")
+	assert.Equal(t, SRC_NONE, arb.Decision().Source)
+	assert.Len(t, arb.History(), 6)
+
+	relay.reject = errors.New("dwell")
+	assert.Equal(t, relay.reject, arb.Request(SRC_SCHEDULE, true, time.Time{}, "pulse"))
+	assert.Equal(t, relay.reject, arb.Decision().Err)
+}
+
+func TestArbiterExpiry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	relay := &fakeRelay{}
+	arb := NewArbiter(relay)
+	decisions := arb.Watch(ctx, &wg)
+	expect := func(src Source, on bool) Decision {
+		select {
+		case dec := <-decisions:
+			assert.Equal(t, src, dec.Source, "Unexpected source for %s", dec.Reason)
+			assert.Equal(t, on, dec.On, "Unexpected state for %s", dec.Reason)
+			return dec
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %s on=%t", src, on)
+		}
+		return Decision{}
+	}
+	arb.Request(SRC_SCHEDULE, false, time.Time{}, "pulse")
+	expect(SRC_SCHEDULE, false)
+	arb.Request(SRC_MANUAL, true, time.Now().Add(100*time.Millisecond), "run for a while")
+	dec := expect(SRC_MANUAL, true)
+	assert.True(t, dec.Remaining(time.Now()) > 0)
+	assert.True(t, relay.IsHigh())
+	// schedule moves on underneath
+	arb.Request(SRC_SCHEDULE, true, time.Time{}, "pulse")
+	expect(SRC_SCHEDULE, true) // override expires on its own, back to where the schedule is now
+	assert.True(t, relay.IsHigh())
+	_, ok := arb.Requested(SRC_MANUAL)
+	assert.False(t, ok)
+}
+
+func TestArbiterBeat(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	relay := &fakeRelay{}
+	var mu sync.Mutex
+	beats := 0
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return beats
+	}
+	arb := NewArbiter(relay).WithBeat(10*time.Millisecond, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		beats++
+	})
+	assert.Nil(t, arb.Request(SRC_SCHEDULE, false, time.Time{}, "pulse"))
+	assert.Equal(t, 1, count(), "switch that goes through beats")
+	relay.reject = errors.New("min off-time")
+	arb.Request(SRC_SCHEDULE, true, time.Time{}, "pulse")
+	assert.Equal(t, 1, count(), "rejected switch does not")
+	relay.reject = nil
+
+	arb.Watch(ctx, &wg)
+	assert.Eventually(t, func() bool { return count() > 3 }, time.Second, 5*time.Millisecond, "watch beats while idle")
+
+	relay.mu.Lock() // relay hangs
+	time.Sleep(30 * time.Millisecond)
+	hung := count()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, hung, count(), "hung relay stops the beats")
+	relay.mu.Unlock()
+	assert.Eventually(t, func() bool { return count() > hung }, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,64 @@
+package control
+
+/* ====================
+Manual override of a relay, out of the schedule.
+During maintenance the pump has to run (or stay off) for a while without editing the schedule or stopping the service.
+Override is a request on the arbiter that forces the relay on or off till a deadline - for a duration or until a clock time.
+Schedule keeps requesting underneath while overridden, so when the override expires the relay goes to the state the schedule would have it in by then.
+==================== */
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_OVERRIDE = 10 * time.Minute // override without a duration lasts this long
+	MAX_OVERRIDE     = 24 * time.Hour   // override cannot be longer than this, a forgotten override should not run the pump for days
+)
+
+var (
+	ErrOverrideArgs = errors.New("invalid override")
+)
+
+// ParseOverride : reads the arguments of the override command
+// first is the state on / off, when missing the relay is flipped from its current state
+// next is the duration like 10m, or the clock time like 15:30 to override till, DEFAULT_OVERRIDE when missing
+//
+/*
+	on, until, err := control.ParseOverride([]string{"on", "10m"}, rs.IsHigh(), time.Now())
+	arb.Request(control.SRC_MANUAL, on, until, "maintenance")
+*/
+func ParseOverride(args []string, current bool, now time.Time) (bool, time.Time, error) {
+	on := !current
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "on":
+			on, args = true, args[1:]
+		case "off":
+			on, args = false, args[1:]
+		}
+	}
+	until := now.Add(DEFAULT_OVERRIDE)
+	if len(args) > 0 {
+		if d, err := time.ParseDuration(args[0]); err == nil {
+			until = now.Add(d)
+		} else if clock, err := time.ParseInLocation("15:04", args[0], now.Location()); err == nil {
+			until = time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+			if !until.After(now) {
+				until = until.AddDate(0, 0, 1) // clock time gone by today is for tomorrow
+			}
+		} else {
+			return false, time.Time{}, fmt.Errorf("%w: %q is neither on/off, a duration nor a clock time", ErrOverrideArgs, args[0])
+		}
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		return false, time.Time{}, fmt.Errorf("%w: unexpected %q", ErrOverrideArgs, strings.Join(args, " "))
+	}
+	if d := until.Sub(now); d <= 0 || d > MAX_OVERRIDE {
+		return false, time.Time{}, fmt.Errorf("%w: duration %s beyond 0-%s", ErrOverrideArgs, d, MAX_OVERRIDE)
+	}
+	return on, until, nil
+}
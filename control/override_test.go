@@ -0,0 +1,37 @@
+package control
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOverride(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.Local)
+	data := []struct {
+		args    []string
+		current bool
+		on      bool
+		until   time.Time
+	}{
+		{nil, false, true, now.Add(DEFAULT_OVERRIDE)},
+		{nil, true, false, now.Add(DEFAULT_OVERRIDE)},
+		{[]string{"on", "10m"}, true, true, now.Add(10 * time.Minute)},
+		{[]string{"OFF"}, false, false, now.Add(DEFAULT_OVERRIDE)},
+		{[]string{"30m"}, false, true, now.Add(30 * time.Minute)},
+		{[]string{"off", "12:30"}, true, false, time.Date(2024, 3, 1, 12, 30, 0, 0, time.Local)},
+		{[]string{"on", "09:15"}, false, true, time.Date(2024, 3, 2, 9, 15, 0, 0, time.Local)},
+	}
+	for _, d := range data {
+		on, until, err := ParseOverride(d.args, d.current, now)
+		assert.Nil(t, err, "Unexpected error for %v", d.args)
+		assert.Equal(t, d.on, on, "Unexpected state for %v", d.args)
+		assert.Equal(t, d.until, until, "Unexpected deadline for %v", d.args)
+	}
+	for _, args := range [][]string{{"on", "soon"}, {"on", "10m", "extra"}, {"-5m"}, {"48h"}} {
+		_, _, err := ParseOverride(args, false, now)
+		assert.True(t, errors.Is(err, ErrOverrideArgs), "Expected error for %v", args)
+	}
+}
@@ -0,0 +1,161 @@
+package control
+
+/* ====================
+Pump driven by the state of the bell siphon rather than the clock.
+Flow sensor on the siphon outlet tells when the siphon locks (drain flow starts) and when the lock breaks (drain flow stops)
+- Siphon locks : pump stops, the growbed drains under gravity alone, which guarantees the lock opens at the slots
+- Lock breaks : pump resumes after a delay, letting the bell vent fully
+When the sensor goes quiet or the siphon misbehaves (never locks, never breaks) the loop falls back to the timed pulse, and returns to sensing as soon as it sees the siphon lock again.
+==================== */
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/eensymachines-in/patio/digital"
+	"github.com/sirupsen/logrus"
+)
+
+type Phase uint8
+
+const (
+	FLOODING Phase = iota // pump on, waiting for the siphon to lock
+	DRAINING              // pump off, siphon locked and draining
+	RESUMING              // pump off, lock broke and waiting out the resume delay
+	FALLBACK              // sensing has failed, pump on the timed pulse
+)
+
+func (ph Phase) String() string {
+	switch ph {
+	case FLOODING:
+		return "flooding"
+	case DRAINING:
+		return "draining"
+	case RESUMING:
+		return "resuming"
+	case FALLBACK:
+		return "fallback"
+	}
+	return "unknown"
+}
+
+const (
+	CONTROL_TICK = 250 * time.Millisecond // resolution of the timeouts, unless the config has it
+)
+
+// SiphonConfig : timings for the siphon aware control
+type SiphonConfig struct {
+	Threshold    float64       // drain flow in L/min above which the siphon is considered locked
+	ResumeDelay  time.Duration // after the lock breaks, pump resumes after this
+	FloodTimeout time.Duration // pump on this long without the siphon locking is a fault
+	DrainTimeout time.Duration // siphon draining this long without the lock breaking is a fault
+	Stale        time.Duration // no readings from the sensor this long is a fault
+	FallbackOn   time.Duration // timed pulse while falling back : pump on
+	FallbackOff  time.Duration // timed pulse while falling back : pump off
+	Tick         time.Duration // resolution of the timeouts, zero for CONTROL_TICK
+}
+
+// Command : desired state of the pump and why
+type Command struct {
+	Pump   bool
+	Phase  Phase
+	At     time.Time
+	Reason string
+}
+
+// SiphonLoop : runs the pump by the siphon state as read from the drain flow
+// sends a command every time the pump has to change state, channel closes when the context is done
+//
+/*
+	readings := drainFlow.Watch(digital.FLOW_POLL, digital.FLOW_REPORT, ctx, &wg)
+	for cmd := range control.SiphonLoop(readings, cfg, ctx, &wg) {
+		if cmd.Pump {
+			rs.High()
+		} else {
+			rs.Low()
+		}
+	}
+*/
+func SiphonLoop(flows <-chan digital.FlowReading, cfg SiphonConfig, ctx context.Context, wg *sync.WaitGroup) chan Command {
+	cmds := make(chan Command, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(cmds)
+		defer logrus.Warn("Now closing siphon control loop..")
+		every := cfg.Tick
+		if every <= 0 {
+			every = CONTROL_TICK
+		}
+		tick := time.NewTicker(every)
+		defer tick.Stop()
+
+		phase, pump := FLOODING, true
+		since, lastReading := time.Now(), time.Now()
+		send := func(ph Phase, on bool, reason string) bool { // false when the context is done
+			phase, pump, since = ph, on, time.Now()
+			logrus.WithFields(logrus.Fields{
+				"phase":  ph,
+				"pump":   on,
+				"reason": reason,
+			}).Info("siphon control")
+			select {
+			case cmds <- Command{Pump: on, Phase: ph, At: since, Reason: reason}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		if !send(FLOODING, true, "start") {
+			return
+		}
+		for {
+			select {
+			case rd, ok := <-flows:
+				if !ok {
+					flows = nil // sensor is gone, the stale timeout would fall back
+					continue
+				}
+				lastReading = rd.At
+				flowing := rd.LPM >= cfg.Threshold
+				sent := true
+				switch {
+				case flowing && (phase == FLOODING || phase == RESUMING):
+					sent = send(DRAINING, false, fmt.Sprintf("siphon locked, drain flow %.2f L/min", rd.LPM))
+				case flowing && phase == FALLBACK && pump:
+					// siphon locked on the timed pulse, sensing works again
+					sent = send(DRAINING, false, fmt.Sprintf("siphon locked on fallback, drain flow %.2f L/min", rd.LPM))
+				case !flowing && phase == DRAINING:
+					sent = send(RESUMING, false, "siphon lock broke")
+				}
+				if !sent {
+					return
+				}
+			case now := <-tick.C:
+				elapsed := now.Sub(since)
+				sent := true
+				switch {
+				case phase != FALLBACK && cfg.Stale > 0 && now.Sub(lastReading) >= cfg.Stale:
+					sent = send(FALLBACK, false, "no readings from the drain flow sensor")
+				case phase == FLOODING && cfg.FloodTimeout > 0 && elapsed >= cfg.FloodTimeout:
+					sent = send(FALLBACK, false, "siphon did not lock in time")
+				case phase == DRAINING && cfg.DrainTimeout > 0 && elapsed >= cfg.DrainTimeout:
+					sent = send(FALLBACK, false, "siphon lock did not break in time")
+				case phase == RESUMING && elapsed >= cfg.ResumeDelay:
+					sent = send(FLOODING, true, "resume delay elapsed")
+				case phase == FALLBACK && pump && elapsed >= cfg.FallbackOn:
+					sent = send(FALLBACK, false, "timed pulse")
+				case phase == FALLBACK && !pump && elapsed >= cfg.FallbackOff:
+					sent = send(FALLBACK, true, "timed pulse")
+				}
+				if !sent {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return cmds
+}
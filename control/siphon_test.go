@@ -0,0 +1,54 @@
+package control
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eensymachines-in/patio/digital"
+	"github.com/stretchr/testify/assert"
+)
+
+func expectCommand(t *testing.T, cmds chan Command, pump bool, phase Phase) {
+	select {
+	case cmd := <-cmds:
+		assert.Equal(t, pump, cmd.Pump, "Unexpected pump state for %s", cmd.Reason)
+		assert.Equal(t, phase, cmd.Phase, "Unexpected phase for %s", cmd.Reason)
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for pump=%t %s", pump, phase)
+	}
+}
+
+func TestSiphonLoop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	flows := make(chan digital.FlowReading, 1)
+	cmds := SiphonLoop(flows, SiphonConfig{
+		Threshold:    0.5,
+		ResumeDelay:  100 * time.Millisecond,
+		FloodTimeout: 300 * time.Millisecond,
+		FallbackOn:   100 * time.Millisecond,
+		FallbackOff:  100 * time.Millisecond,
+		Tick:         10 * time.Millisecond,
+	}, ctx, &wg)
+	expectCommand(t, cmds, true, FLOODING)
+
+	flows <- digital.FlowReading{At: time.Now(), LPM: 4}
+	expectCommand(t, cmds, false, DRAINING)
+
+	flows <- digital.FlowReading{At: time.Now(), LPM: 0}
+	expectCommand(t, cmds, false, RESUMING)
+	expectCommand(t, cmds, true, FLOODING)
+
+	// siphon never locks, falls back to the timed pulse
+	expectCommand(t, cmds, false, FALLBACK)
+	expectCommand(t, cmds, true, FALLBACK)
+
+	// siphon locks on the timed pulse, back to sensing
+	flows <- digital.FlowReading{At: time.Now(), LPM: 4}
+	expectCommand(t, cmds, false, DRAINING)
+}
@@ -1,8 +1,11 @@
 package digital
 
 import (
+	"context"
+	"sync"
 	"time"
 
+	"github.com/sirupsen/logrus"
 	"gobot.io/x/gobot"
 	"gobot.io/x/gobot/drivers/gpio"
 )
@@ -14,6 +17,9 @@ Most of the IoT applications would run an infinite loop (main) to do all the tas
 buttons bring in the functionality of interrupting the loop, and doing a task that prempts the main tasks
 typically used for emergency / manual intervention.
 23-FEB-2024 | kneerunjun@gmail.com | eensymachines.in |
+
+Button is debounced and edge triggered, instead of the raw level it emits press & release events along with short, long & double press gestures.
+One physical button can thus handle several manual actions.
 ============================
 */
 type BTN_PULL uint8 // pull resistor, and the initial state of the button
@@ -25,24 +31,32 @@ const (
 	BTN_PULLUP
 )
 
+const (
+	BTN_POLL = 10 * time.Millisecond // sampling interval, has to be well within the debounce time
+)
+
 // When the gpio goes high, this shall interrupt
 type InterruptButton struct {
 	*gpio.DirectPinDriver
-	state bool // state is in synch with the h/w pin state
-	pull  uint8
+	mu       sync.Mutex
+	state    bool // state is in synch with the debounced button state, true when pressed
+	pull     uint8
+	gestures GestureConfig
+	chip     GpioChip // edges from the gpio chip when not nil, else the pin is polled
 }
 
 // NewInterruptButton : ctor for interrupt buttons
 //
 /*
-	cancel := make(chan bool, 1)
-	defer close(cancel)
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
 	r := raspi.NewAdaptor()
 	r.Connect()
 	btn := digital.NewInterruptButton("33", digital.BTN_PULLUP, r)
-	for t := range btn.Start(cancel, 500*time.Millisecond) {
-		fmt.Println(t)
-		return
+	for evt := range btn.Start(digital.BTN_POLL, ctx, &wg) {
+		if evt.Kind == digital.LONG_PRESS {
+			cancel()
+		}
 	}
 */
 func NewInterruptButton(pin string, pullupdown uint8, adp gobot.Adaptor) *InterruptButton {
@@ -50,31 +64,106 @@ func NewInterruptButton(pin string, pullupdown uint8, adp gobot.Adaptor) *Interr
 		DirectPinDriver: gpio.NewDirectPinDriver(adp, pin),
 		state:           false,
 		pull:            pullupdown,
+		gestures:        DEFAULT_GESTURES,
 	}
 }
 
-func (ib *InterruptButton) Start(canc chan bool, interval time.Duration) chan time.Time {
-	chanIntrpt := make(chan time.Time, 200)
+// WithGestures : overrides the default debounce & gesture timings, call before Start
+func (ib *InterruptButton) WithGestures(cfg GestureConfig) *InterruptButton {
+	ib.gestures = cfg
+	return ib
+}
+
+// WithChip : button is then read as edge events from the gpio chip, polling only if the line cannot be had
+func (ib *InterruptButton) WithChip(chip GpioChip) *InterruptButton {
+	ib.chip = chip
+	return ib
+}
+
+// IsPressed : debounced state of the button
+func (ib *InterruptButton) IsPressed() bool {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	return ib.state
+}
+
+// Start : samples the button every interval and sends out debounced press events & gestures
+// loop closes the channel when the context is done
+// with the gpio chip, the button is sampled only while a gesture is in progress and the edges come in from the kernel
+func (ib *InterruptButton) Start(interval time.Duration, ctx context.Context, wg *sync.WaitGroup) chan PressEvent {
+	chanIntrpt := make(chan PressEvent, 20)
+	emit := func(detector *PressDetector) func(PressEvent) bool {
+		return func(evt PressEvent) bool {
+			ib.mu.Lock()
+			ib.state = detector.IsPressed()
+			ib.mu.Unlock()
+			select {
+			case chanIntrpt <- evt:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+	}
+	if edges, level := ib.lineEvents(ctx, wg); edges != nil {
+		detector := NewPressDetector(ib.gestures)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(chanIntrpt)
+			defer logrus.Warn("Now closing button watch..")
+			feedEdges(edges, level, ib.pull == BTN_PULLDOWN, detector, interval, ctx, emit(detector))
+		}()
+		return chanIntrpt
+	}
 	if ib.pull == BTN_PULLUP {
 		ib.DirectPinDriver.DigitalWrite(0) // to start with the pin will be low
 	} else if ib.pull == BTN_PULLDOWN {
 		ib.DirectPinDriver.DigitalWrite(1)
 	}
+	detector := NewPressDetector(ib.gestures)
+	send := emit(detector)
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
+		defer close(chanIntrpt)
+		defer logrus.Warn("Now closing button watch..")
 		for {
 			select {
-			// NOTE: about 500 msecs should a good starting point to test
 			case <-time.After(interval):
-				val, _ := ib.DirectPinDriver.DigitalRead()
-				if (val == 1 && ib.pull == BTN_PULLUP) || (val == 0 && ib.pull == BTN_PULLDOWN) {
-					// the button was pressed
-					chanIntrpt <- time.Now()
+				val, err := ib.DirectPinDriver.DigitalRead()
+				if err != nil {
+					continue // transient read errors are as good as no change
+				}
+				pressed := (val == 1 && ib.pull == BTN_PULLUP) || (val == 0 && ib.pull == BTN_PULLDOWN)
+				for _, evt := range detector.Feed(pressed, time.Now()) {
+					if !send(evt) {
+						return
+					}
 				}
-			case <-canc:
-				close(chanIntrpt)
+			case <-ctx.Done():
 				return
 			}
 		}
 	}()
 	return chanIntrpt
 }
+
+// lineEvents : edges on the button line from the gpio chip, nil when polling
+func (ib *InterruptButton) lineEvents(ctx context.Context, wg *sync.WaitGroup) (chan Edge, bool) {
+	if ib.chip == nil {
+		return nil, false
+	}
+	line, err := ib.chip.RequestEvents(ib.Pin(), "button")
+	if err != nil {
+		logrus.Warnf("button falls back to polling: %s", err)
+		return nil, false
+	}
+	level, err := line.Value()
+	if err != nil {
+		line.Close()
+		logrus.Warnf("button falls back to polling: %s", err)
+		return nil, false
+	}
+	return WatchEdges(line, ctx, wg), level
+}
@@ -1,35 +1,213 @@
 package digital
 
+/* ====================
+ErrLED is the only way the box can talk to someone standing at the enclosure.
+Each class of fault has its own blink code - n short blinks followed by a long pause. When more than one fault is active the codes are played one after the other.
+No fault, LED stays off. Faults that dont fit any class keep the LED steady on.
+==================== */
 import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
 	"github.com/sirupsen/logrus"
 	"gobot.io/x/gobot"
 	"gobot.io/x/gobot/drivers/gpio"
 )
 
+type FaultCode uint8
+
+// Fault classes, the value of the code is the number of blinks
+const (
+	FAULT_OTHER  FaultCode = iota // unclassified fault, steady on
+	FAULT_BROKER                  // 1 blink : broker unreachable
+	FAULT_CONFIG                  // 2 blinks : configuration invalid
+	FAULT_RELAY                   // 3 blinks : relay did not switch as commanded
+	FAULT_SENSOR                  // 4 blinks : sensor reading out of range
+	FAULT_WATER                   // 5 blinks : fish tank leaking or low on water
+)
+
+func (fc FaultCode) String() string {
+	switch fc {
+	case FAULT_BROKER:
+		return "broker unreachable"
+	case FAULT_CONFIG:
+		return "config invalid"
+	case FAULT_RELAY:
+		return "relay verify failure"
+	case FAULT_SENSOR:
+		return "sensor out of range"
+	case FAULT_WATER:
+		return "tank water loss"
+	}
+	return "other"
+}
+
+const (
+	BLINK_ON    = 250 * time.Millisecond  // led on for each blink
+	BLINK_OFF   = 350 * time.Millisecond  // led off between blinks
+	BLINK_PAUSE = 2000 * time.Millisecond // led off between codes
+)
+
+// fault : active fault from a source
+type fault struct {
+	code FaultCode
+	err  error
+}
+
 type ErrLED struct {
 	*gpio.DirectPinDriver
-	state bool // represents the state of the pin
+	mu     sync.Mutex
+	state  bool             // represents the state of the pin
+	faults map[string]fault // active faults by their sources
+	after  func(d time.Duration) <-chan time.Time
 }
 
 func NewErrLED(pin string, adp gobot.Adaptor) *ErrLED {
 	return &ErrLED{
 		state:           false,
 		DirectPinDriver: gpio.NewDirectPinDriver(adp, pin),
+		faults:          map[string]fault{},
+		after:           time.After,
 	}
 }
+
+// Log : logs the error and raises an unclassified fault
 func (el *ErrLED) Log(err error) {
-	logrus.Error(err)
-	el.DirectPinDriver.DigitalWrite(1)
+	el.Raise(FAULT_OTHER, err)
+}
+
+// Raise : marks the fault class active, the error is logged only when the fault is new
+func (el *ErrLED) Raise(code FaultCode, err error) {
+	el.RaiseFrom(code.String(), code, err)
+}
+
+// Clear : marks the fault class inactive, clearing an inactive fault is harmless
+func (el *ErrLED) Clear(code FaultCode) {
+	el.ClearFrom(code.String())
 }
+
+// RaiseFrom : same as Raise, but for when more than one source can raise the same fault class
+// fault class stays active till all the sources have cleared it
+func (el *ErrLED) RaiseFrom(source string, code FaultCode, err error) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	if _, ok := el.faults[source]; !ok {
+		logrus.WithFields(logrus.Fields{
+			"fault":  code,
+			"source": source,
+		}).Error(err)
+	}
+	el.faults[source] = fault{code: code, err: err}
+}
+
+// ClearFrom : clears the fault raised by the source
+func (el *ErrLED) ClearFrom(source string) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	if f, ok := el.faults[source]; ok {
+		logrus.WithFields(logrus.Fields{
+			"fault":  f.code,
+			"source": source,
+		}).Info("fault cleared")
+		delete(el.faults, source)
+	}
+}
+
+// Faults : copy of the active fault classes along with an error that raised them
+func (el *ErrLED) Faults() map[FaultCode]error {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	active := make(map[FaultCode]error, len(el.faults))
+	for _, f := range el.faults {
+		active[f.code] = f.err
+	}
+	return active
+}
+
 func (el *ErrLED) Boot() *ErrLED {
-	el.DirectPinDriver.DigitalWrite(0) // to start with the pin is off
+	el.write(false) // to start with the pin is off
 	return el
 }
 
 func (el *ErrLED) IsHigh() bool {
+	el.mu.Lock()
+	defer el.mu.Unlock()
 	return el.state
 }
 
 func (el *ErrLED) ShutD() {
-	el.DirectPinDriver.DigitalWrite(0)
+	el.write(false)
+}
+
+func (el *ErrLED) write(on bool) {
+	level := byte(0)
+	if on {
+		level = 1
+	}
+	if err := el.DirectPinDriver.DigitalWrite(level); err != nil {
+		return
+	}
+	el.mu.Lock()
+	el.state = on
+	el.mu.Unlock()
+}
+
+// blinkStep : led held on / off for a while
+type blinkStep struct {
+	on bool
+	d  time.Duration
+}
+
+// blinkSteps : one round of the blink codes for the active faults, in the order of the codes
+// n short blinks & a pause for each fault class, steady on for the unclassified, off for a pause when there is none
+func blinkSteps(active map[FaultCode]error) []blinkStep {
+	codes := make([]int, 0, len(active))
+	for code := range active {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+	if len(codes) == 0 {
+		return []blinkStep{{false, BLINK_PAUSE}}
+	}
+	steps := []blinkStep{}
+	for _, code := range codes {
+		if code == int(FAULT_OTHER) {
+			steps = append(steps, blinkStep{true, BLINK_PAUSE}, blinkStep{false, BLINK_OFF})
+			continue
+		}
+		for i := 0; i < code; i++ {
+			steps = append(steps, blinkStep{true, BLINK_ON}, blinkStep{false, BLINK_OFF})
+		}
+		steps = append(steps, blinkStep{false, BLINK_PAUSE})
+	}
+	return steps
+}
+
+// Blink : plays the blink codes of the active faults till the context is done, led is switched off when done
+//
+/*
+	errled := digital.NewErrLED(os.Getenv("GPIO_ERRLED"), r).Boot()
+	errled.Blink(ctx, &wg)
+	errled.Raise(digital.FAULT_CONFIG, fmt.Errorf("invalid schedule"))
+*/
+func (el *ErrLED) Blink(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer el.ShutD()
+		defer logrus.Warn("Now closing error led..")
+		for {
+			// faults raised or cleared meanwhile are picked up with the next round
+			for _, step := range blinkSteps(el.Faults()) {
+				el.write(step.on)
+				select {
+				case <-el.after(step.d):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
 }
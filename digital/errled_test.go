@@ -0,0 +1,61 @@
+package digital
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlinkSteps(t *testing.T) {
+	assert.Equal(t, []blinkStep{{false, BLINK_PAUSE}}, blinkSteps(nil), "no fault, led stays off")
+
+	steps := blinkSteps(map[FaultCode]error{
+		FAULT_RELAY:  errors.New("feedback"),
+		FAULT_BROKER: errors.New("unreachable"),
+	})
+	blink, off, pause := blinkStep{true, BLINK_ON}, blinkStep{false, BLINK_OFF}, blinkStep{false, BLINK_PAUSE}
+	assert.Equal(t, []blinkStep{
+		blink, off, pause, // broker, 1 blink
+		blink, off, blink, off, blink, off, pause, // relay, 3 blinks
+	}, steps, "codes are played in order, each followed by a pause")
+
+	steps = blinkSteps(map[FaultCode]error{FAULT_OTHER: errors.New("other")})
+	assert.Equal(t, []blinkStep{{true, BLINK_PAUSE}, off}, steps, "unclassified fault is steady on")
+}
+
+func TestBlink(t *testing.T) {
+	fa := newFakeAdaptor()
+	el := NewErrLED("40", fa).Boot()
+	// each step waits till the test lets it through, led level is checked in between
+	waits, done := make(chan time.Duration), make(chan time.Time)
+	el.after = func(d time.Duration) <-chan time.Time {
+		waits <- d
+		return done
+	}
+	el.Raise(FAULT_BROKER, errors.New("unreachable"))
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	el.Blink(ctx, &wg)
+
+	assert.Equal(t, BLINK_ON, <-waits)
+	assert.True(t, el.IsHigh(), "first blink of the code")
+	done <- time.Now()
+	assert.Equal(t, BLINK_OFF, <-waits)
+	assert.False(t, el.IsHigh(), "off between blinks")
+	done <- time.Now()
+	assert.Equal(t, BLINK_PAUSE, <-waits, "pause after the code")
+	assert.False(t, el.IsHigh())
+
+	el.Clear(FAULT_BROKER)
+	done <- time.Now()
+	assert.Equal(t, BLINK_PAUSE, <-waits, "cleared fault is gone from the next round")
+	assert.False(t, el.IsHigh())
+
+	cancel()
+	wg.Wait()
+	assert.Equal(t, 0, fa.level("40"), "led is off once done")
+}
@@ -0,0 +1,194 @@
+package digital
+
+/* ====================
+Hall effect water flow sensors (YF-S201 and the like) put out a pulse for every fixed volume of water through them.
+K-factor is the number of pulses per litre (~450 for YF-S201), and is printed on the sensor or found by calibration.
+Sensor is placed on the siphon outlet, flow there tells when the siphon has locked and when the lock has opened.
+Pulses are counted from the edge events on the gpio chip when there is one, else by polling the pin fast enough - which keeps a Pi Zero busy, so polling is only the fallback.
+==================== */
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gobot.io/x/gobot"
+	"gobot.io/x/gobot/drivers/gpio"
+)
+
+const (
+	FLOW_POLL       = 1 * time.Millisecond // YF-S201 at 30 L/min pulses ~225Hz, polling has to be atleast twice as fast - only when the chip cannot be had
+	FLOW_REPORT     = 1 * time.Second      // flow rate is averaged over this window
+	DEFAULT_KFACTOR = 450.0                // pulses per litre for YF-S201
+)
+
+// FlowReading : one reading from the flow sensor
+type FlowReading struct {
+	At     time.Time
+	LPM    float64 // flow rate over the last window, litres per minute
+	Litres float64 // total since the sensor was booted
+	Pulses uint64  // total pulses since the sensor was booted
+}
+
+// FlowSensor : counts the pulses from the flow sensor
+type FlowSensor struct {
+	*gpio.DirectPinDriver
+	kfactor float64
+	mu      sync.Mutex
+	pulses  uint64
+	level   int      // last level read when polling
+	chip    GpioChip // pulses are counted from the edges on the chip when not nil, else the pin is polled
+}
+
+// NewFlowSensor : ctor for the flow sensor
+// kfactor	: pulses per litre, non positive values fall back to DEFAULT_KFACTOR
+//
+/*
+	fs := digital.NewFlowSensor("36", 450, r).WithChip(chip).Boot()
+	for rd := range fs.Watch(digital.FLOW_POLL, digital.FLOW_REPORT, ctx, &wg) {
+		log.Debugf("flow %.2f L/min", rd.LPM)
+	}
+*/
+func NewFlowSensor(pin string, kfactor float64, adp gobot.Adaptor) *FlowSensor {
+	if kfactor <= 0 {
+		kfactor = DEFAULT_KFACTOR
+	}
+	return &FlowSensor{
+		DirectPinDriver: gpio.NewDirectPinDriver(adp, pin),
+		kfactor:         kfactor,
+	}
+}
+
+// WithChip : pulses are then counted from the edge events on the gpio chip, polling only if the line cannot be had
+// nil chip leaves the sensor polled
+func (fs *FlowSensor) WithChip(chip GpioChip) *FlowSensor {
+	fs.chip = chip
+	return fs
+}
+
+// Boot : resets the count
+func (fs *FlowSensor) Boot() *FlowSensor {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.pulses = 0
+	if fs.chip == nil {
+		fs.level, _ = fs.DirectPinDriver.DigitalRead()
+	}
+	return fs
+}
+
+// Pulse : adds pulses to the count, edge event sources call this for every rising edge
+func (fs *FlowSensor) Pulse(n uint64) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.pulses += n
+}
+
+// Pulses : total pulses counted since boot
+func (fs *FlowSensor) Pulses() uint64 {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.pulses
+}
+
+// Litres : total volume since boot
+func (fs *FlowSensor) Litres() float64 {
+	return float64(fs.Pulses()) / fs.kfactor
+}
+
+// reading : converts the pulses counted over a window to a reading
+func (fs *FlowSensor) reading(window time.Duration, pulses, total uint64, at time.Time) FlowReading {
+	return FlowReading{
+		At:     at,
+		LPM:    float64(pulses) / fs.kfactor / window.Minutes(),
+		Litres: float64(total) / fs.kfactor,
+		Pulses: total,
+	}
+}
+
+// poll : reads the pin and counts a rising edge
+func (fs *FlowSensor) poll() {
+	val, err := fs.DirectPinDriver.DigitalRead()
+	if err != nil {
+		return
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if val == 1 && fs.level == 0 {
+		fs.pulses++
+	}
+	fs.level = val
+}
+
+// lineEvents : edges on the sensor line from the gpio chip, nil when polling
+func (fs *FlowSensor) lineEvents(ctx context.Context, wg *sync.WaitGroup) chan Edge {
+	if fs.chip == nil {
+		return nil
+	}
+	line, err := fs.chip.RequestEvents(fs.Pin(), "flow")
+	if err != nil {
+		logrus.Warnf("flow sensor falls back to polling: %s", err)
+		// Boot left the level unread when on the chip, a pin already high is not a pulse
+		fs.mu.Lock()
+		fs.level, _ = fs.DirectPinDriver.DigitalRead()
+		fs.mu.Unlock()
+		return nil
+	}
+	return WatchEdges(line, ctx, wg)
+}
+
+// Watch : counts pulses and sends out a reading every report interval
+// poll 	: interval at which the pin is polled when the chip cannot be had, zero when the pulses are fed in with Pulse
+// When the listener isnt ready the older reading is dropped for the latest one
+func (fs *FlowSensor) Watch(poll, report time.Duration, ctx context.Context, wg *sync.WaitGroup) chan FlowReading {
+	readings := make(chan FlowReading, 1)
+	if edges := fs.lineEvents(ctx, wg); edges != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range edges {
+				if e.Rising {
+					fs.Pulse(1)
+				}
+			}
+		}()
+	} else if poll > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tick := time.NewTicker(poll) // polling is too fast to allocate a timer every time
+			defer tick.Stop()
+			for {
+				select {
+				case <-tick.C:
+					fs.poll()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer logrus.Warn("Now closing flow sensor..")
+		defer wg.Done()
+		defer close(readings)
+		last, lastAt := fs.Pulses(), time.Now()
+		for {
+			select {
+			case <-time.After(report):
+				now, total := time.Now(), fs.Pulses()
+				rd := fs.reading(now.Sub(lastAt), total-last, total, now)
+				last, lastAt = total, now
+				select {
+				case <-readings: // listener is lagging, only the latest reading matters
+				default:
+				}
+				readings <- rd
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return readings
+}
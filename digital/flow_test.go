@@ -0,0 +1,87 @@
+package digital
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlowKFactor(t *testing.T) {
+	fs := NewFlowSensor("36", 0, newFakeAdaptor()).Boot()
+	assert.Equal(t, DEFAULT_KFACTOR, fs.kfactor, "non positive k-factor falls back to the default")
+
+	fs = NewFlowSensor("36", 450, newFakeAdaptor()).Boot()
+	fs.Pulse(900)
+	assert.InDelta(t, 2.0, fs.Litres(), 1e-9)
+
+	at := time.Now()
+	rd := fs.reading(30*time.Second, 225, 900, at)
+	assert.InDelta(t, 1.0, rd.LPM, 1e-9, "225 pulses in half a minute is 1 L/min at 450 per litre")
+	assert.InDelta(t, 2.0, rd.Litres, 1e-9)
+	assert.Equal(t, uint64(900), rd.Pulses)
+	assert.Equal(t, at, rd.At)
+}
+
+func TestFlowPolling(t *testing.T) {
+	adp := newFakeAdaptor()
+	fs := NewFlowSensor("36", 450, adp).Boot()
+	for _, lvl := range []int{0, 1, 1, 0, 1, 0, 0, 1} {
+		adp.set("36", lvl)
+		fs.poll()
+	}
+	assert.Equal(t, uint64(3), fs.Pulses(), "rising edges only are counted")
+}
+
+func TestFlowFromEdges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	chip := newFakeChip()
+	adp := newFakeAdaptor()
+	fs := NewFlowSensor("36", 450, adp).WithChip(chip).Boot()
+	readings := fs.Watch(FLOW_POLL, 50*time.Millisecond, ctx, &wg)
+
+	line := chip.lines["36"]
+	if assert.NotNil(t, line, "line is requested from the chip") {
+		at := time.Now()
+		for i := 0; i < 45; i++ {
+			line.edge(true, at)
+			line.edge(false, at)
+		}
+	}
+	assert.Eventually(t, func() bool { return fs.Pulses() == 45 }, time.Second, 5*time.Millisecond)
+	adp.set("36", 1)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, uint64(45), fs.Pulses(), "pin is not polled when on the chip")
+	rd := <-readings
+	for rd.Pulses < 45 {
+		rd = <-readings
+	}
+	assert.InDelta(t, 0.1, rd.Litres, 1e-9)
+	cancel()
+	wg.Wait()
+}
+
+func TestFlowChipFallback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	chip := newFakeChip()
+	chip.err = errors.New("no line events")
+	adp := newFakeAdaptor()
+	adp.set("36", 1)
+	fs := NewFlowSensor("36", 450, adp).WithChip(chip).Boot()
+	fs.Watch(time.Millisecond, time.Second, ctx, &wg)
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, uint64(0), fs.Pulses(), "pin high to start with is no pulse")
+	cancel()
+	wg.Wait()
+	adp.set("36", 0)
+	fs.poll()
+	adp.set("36", 1)
+	fs.poll()
+	assert.Equal(t, uint64(1), fs.Pulses(), "polling counts from there on")
+}
@@ -0,0 +1,141 @@
+package digital
+
+/* ====================
+Buttons and touch sensors are both read as a digital level, and one physical input can do more than one manual action if we can tell a short press from a long one or a double press.
+PressDetector is fed the raw pin levels (from polling or edge events), debounces them and emits press gestures.
+It holds no goroutines of its own, drivers feed it from their watch loops.
+==================== */
+import (
+	"time"
+)
+
+type PressKind uint8
+
+const (
+	PRESS        PressKind = iota // debounced edge, input is now pressed
+	RELEASE                       // debounced edge, input is now released
+	SHORT_PRESS                   // pressed & released quickly, no second press followed
+	LONG_PRESS                    // held for atleast the long press duration, sent while still held
+	DOUBLE_PRESS                  // 2 short presses in quick succession
+)
+
+func (pk PressKind) String() string {
+	switch pk {
+	case PRESS:
+		return "press"
+	case RELEASE:
+		return "release"
+	case SHORT_PRESS:
+		return "short"
+	case LONG_PRESS:
+		return "long"
+	case DOUBLE_PRESS:
+		return "double"
+	}
+	return "unknown"
+}
+
+// PressEvent : one event from a button / touch sensor
+type PressEvent struct {
+	Kind PressKind
+	At   time.Time     // time of the (debounced) edge that lead to the event
+	Held time.Duration // for release and gestures, how long the input was held
+}
+
+// GestureConfig : timings for telling gestures apart
+type GestureConfig struct {
+	Debounce  time.Duration // level has to be stable this long to be considered an edge
+	LongPress time.Duration // holding this long is a long press
+	DoubleGap time.Duration // second press within this much of the first release makes a double press
+}
+
+var (
+	// DEFAULT_GESTURES : timings that work well with the tactile buttons and grove touch sensor
+	DEFAULT_GESTURES = GestureConfig{
+		Debounce:  50 * time.Millisecond,
+		LongPress: 3 * time.Second,
+		DoubleGap: 400 * time.Millisecond,
+	}
+)
+
+// PressDetector : state machine that turns raw levels into press events
+// Not safe for concurrent use, feed it from a single loop
+type PressDetector struct {
+	cfg      GestureConfig
+	raw      bool      // last raw level fed in
+	rawSince time.Time // time raw level last changed
+	pressed  bool      // debounced level
+	pressAt  time.Time // time of the last debounced press
+	longSent bool      // long press was sent for the current hold
+	second   bool      // current press is the second of a possible double press
+	waiting  bool      // a short press was released, waiting to see if a second one follows
+	relAt    time.Time // time of the last debounced release
+}
+
+// NewPressDetector : ctor for the detector, zero values in the config are taken from DEFAULT_GESTURES
+func NewPressDetector(cfg GestureConfig) *PressDetector {
+	if cfg.Debounce <= 0 {
+		cfg.Debounce = DEFAULT_GESTURES.Debounce
+	}
+	if cfg.LongPress <= 0 {
+		cfg.LongPress = DEFAULT_GESTURES.LongPress
+	}
+	if cfg.DoubleGap <= 0 {
+		cfg.DoubleGap = DEFAULT_GESTURES.DoubleGap
+	}
+	return &PressDetector{cfg: cfg}
+}
+
+// IsPressed : debounced state of the input
+func (pd *PressDetector) IsPressed() bool {
+	return pd.pressed
+}
+
+// Idle : true when the input is released and no gesture is pending, feeding it again would not emit anything till the level changes
+func (pd *PressDetector) Idle() bool {
+	return !pd.raw && !pd.pressed && !pd.waiting
+}
+
+// Feed : level of the input at the given time, returns events if any
+// Call this for every sample, even when the level has not changed, since gestures complete with the passage of time
+func (pd *PressDetector) Feed(level bool, at time.Time) []PressEvent {
+	evts := []PressEvent{}
+	if level != pd.raw || pd.rawSince.IsZero() {
+		pd.raw, pd.rawSince = level, at
+	}
+	if pd.raw != pd.pressed && at.Sub(pd.rawSince) >= pd.cfg.Debounce {
+		edge := pd.rawSince
+		pd.pressed = pd.raw
+		if pd.pressed {
+			if pd.waiting && edge.Sub(pd.relAt) > pd.cfg.DoubleGap {
+				// gap ran out before this press, with no sample in between to tell
+				evts = append(evts, PressEvent{Kind: SHORT_PRESS, At: pd.relAt, Held: pd.relAt.Sub(pd.pressAt)})
+			}
+			pd.pressAt, pd.longSent = edge, false
+			pd.second = pd.waiting && edge.Sub(pd.relAt) <= pd.cfg.DoubleGap
+			pd.waiting = false
+			evts = append(evts, PressEvent{Kind: PRESS, At: edge})
+		} else {
+			held := edge.Sub(pd.pressAt)
+			pd.relAt = edge
+			evts = append(evts, PressEvent{Kind: RELEASE, At: edge, Held: held})
+			if !pd.longSent {
+				if pd.second {
+					evts = append(evts, PressEvent{Kind: DOUBLE_PRESS, At: edge, Held: held})
+				} else {
+					pd.waiting = true
+				}
+			}
+			pd.second = false
+		}
+	}
+	if pd.pressed && !pd.longSent && at.Sub(pd.pressAt) >= pd.cfg.LongPress {
+		pd.longSent, pd.second = true, false
+		evts = append(evts, PressEvent{Kind: LONG_PRESS, At: at, Held: at.Sub(pd.pressAt)})
+	}
+	if pd.waiting && !pd.pressed && !pd.raw && at.Sub(pd.relAt) > pd.cfg.DoubleGap {
+		pd.waiting = false
+		evts = append(evts, PressEvent{Kind: SHORT_PRESS, At: pd.relAt, Held: pd.relAt.Sub(pd.pressAt)})
+	}
+	return evts
+}
@@ -0,0 +1,72 @@
+package digital
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// feedLevels : feeds the detector a level every 10ms for the duration, collects the gestures
+func feedLevels(pd *PressDetector, start *time.Time, level bool, d time.Duration) []PressKind {
+	kinds := []PressKind{}
+	for end := start.Add(d); start.Before(end); *start = start.Add(10 * time.Millisecond) {
+		for _, e := range pd.Feed(level, *start) {
+			kinds = append(kinds, e.Kind)
+		}
+	}
+	return kinds
+}
+
+func TestPressGestures(t *testing.T) {
+	cfg := GestureConfig{Debounce: 50 * time.Millisecond, LongPress: time.Second, DoubleGap: 300 * time.Millisecond}
+	now := time.Now()
+
+	pd := NewPressDetector(cfg)
+	kinds := feedLevels(pd, &now, false, 100*time.Millisecond)
+	kinds = append(kinds, feedLevels(pd, &now, true, 200*time.Millisecond)...)
+	kinds = append(kinds, feedLevels(pd, &now, false, 500*time.Millisecond)...)
+	assert.Equal(t, []PressKind{PRESS, RELEASE, SHORT_PRESS}, kinds, "short press")
+
+	pd = NewPressDetector(cfg)
+	kinds = feedLevels(pd, &now, true, 1500*time.Millisecond)
+	kinds = append(kinds, feedLevels(pd, &now, false, 500*time.Millisecond)...)
+	assert.Equal(t, []PressKind{PRESS, LONG_PRESS, RELEASE}, kinds, "long press")
+
+	pd = NewPressDetector(cfg)
+	kinds = feedLevels(pd, &now, true, 150*time.Millisecond)
+	kinds = append(kinds, feedLevels(pd, &now, false, 150*time.Millisecond)...)
+	kinds = append(kinds, feedLevels(pd, &now, true, 150*time.Millisecond)...)
+	kinds = append(kinds, feedLevels(pd, &now, false, 500*time.Millisecond)...)
+	assert.Equal(t, []PressKind{PRESS, RELEASE, PRESS, RELEASE, DOUBLE_PRESS}, kinds, "double press")
+
+	pd = NewPressDetector(cfg)
+	kinds = feedLevels(pd, &now, false, 100*time.Millisecond)
+	for i := 0; i < 5; i++ { // chatter shorter than the debounce
+		kinds = append(kinds, feedLevels(pd, &now, true, 20*time.Millisecond)...)
+		kinds = append(kinds, feedLevels(pd, &now, false, 20*time.Millisecond)...)
+	}
+	kinds = append(kinds, feedLevels(pd, &now, false, 500*time.Millisecond)...)
+	assert.Empty(t, kinds, "bounces should not register")
+}
+
+func TestPressAfterGap(t *testing.T) {
+	cfg := GestureConfig{Debounce: 50 * time.Millisecond, LongPress: time.Second, DoubleGap: 300 * time.Millisecond}
+	now := time.Now()
+	pd := NewPressDetector(cfg)
+	kinds := []PressKind{}
+	// fed on edges only, and once more after the debounce, as from the edge events
+	for _, fd := range []struct {
+		level bool
+		after time.Duration
+	}{
+		{true, 0}, {true, 60 * time.Millisecond},
+		{false, 150 * time.Millisecond}, {false, 210 * time.Millisecond},
+		{true, 800 * time.Millisecond}, {true, 860 * time.Millisecond}, // next press past the gap, before any sample to close it
+	} {
+		for _, e := range pd.Feed(fd.level, now.Add(fd.after)) {
+			kinds = append(kinds, e.Kind)
+		}
+	}
+	assert.Equal(t, []PressKind{PRESS, RELEASE, SHORT_PRESS, PRESS}, kinds, "first press is short, second is not a double")
+}
@@ -0,0 +1,248 @@
+package digital
+
+/* ====================
+Polling a touch sensor or a button every few hundred ms misses the short touches, and keeps a Pi Zero busy doing nothing.
+Linux GPIO character device (/dev/gpiochipN) can instead have the kernel detect the edges, and time stamp them as they happen.
+Line is requested for events (v1 ABI - GPIO_GET_LINEEVENT_IOCTL), and then reading the line fd blocks till the next edge.
+Watch loops of the touch sensor & button use the edges when a chip is given, and fall back to polling when the chip or the line cannot be had.
+Pins are still the physical header pins as with the raspi adaptor, mapped here to the BCM line offsets on gpiochip0.
+==================== */
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DEFAULT_GPIOCHIP = "/dev/gpiochip0"
+	EVENT_SIZE       = 16 // struct gpioevent_data : u64 timestamp, u32 id, padded to 8
+
+	GPIO_GET_LINEEVENT_IOCTL         = 0xc030b404 // _IOWR(0xB4, 0x04, struct gpioevent_request)
+	GPIOHANDLE_GET_LINE_VALUES_IOCTL = 0xc040b408 // _IOWR(0xB4, 0x08, struct gpiohandle_data)
+	GPIOHANDLE_REQUEST_INPUT         = 1 << 0
+	GPIOEVENT_REQUEST_BOTH_EDGES     = 1<<0 | 1<<1
+	GPIOEVENT_EVENT_RISING_EDGE      = 0x01
+	GPIOEVENT_EVENT_FALLING_EDGE     = 0x02
+)
+
+var (
+	ErrNoLine = errors.New("pin has no line on the gpio chip")
+	// physToBCM : physical header pin on the raspberry pi to the line offset on gpiochip0
+	physToBCM = map[string]uint32{
+		"3": 2, "5": 3, "7": 4, "8": 14, "10": 15, "11": 17, "12": 18, "13": 27, "15": 22, "16": 23,
+		"18": 24, "19": 10, "21": 9, "22": 25, "23": 11, "24": 8, "26": 7, "27": 0, "28": 1, "29": 5,
+		"31": 6, "32": 12, "33": 13, "35": 19, "36": 16, "37": 26, "38": 20, "40": 21,
+	}
+)
+
+// Edge : level change on an input line as detected by the kernel
+type Edge struct {
+	Rising bool      // line went high
+	At     time.Time // time the kernel saw the edge
+}
+
+// GpioChip : gpio controller that can watch input lines for edges
+type GpioChip interface {
+	RequestEvents(pin string, consumer string) (EventLine, error)
+}
+
+// EventLine : input line requested for edge events
+// reading gives out the kernel gpioevent_data records, closing it releases the line
+type EventLine interface {
+	io.ReadCloser
+	Value() (bool, error) // current level of the line
+}
+
+// charDevChip : gpio character device
+type charDevChip struct {
+	f *os.File
+}
+
+// OpenGpioChip : opens the gpio character device, path is typically DEFAULT_GPIOCHIP
+//
+/*
+	chip, err := digital.OpenGpioChip(digital.DEFAULT_GPIOCHIP)
+	if err != nil {
+		chip = nil // watches would poll
+	}
+	touch := digital.NewTouchSensor("31", r).WithChip(chip).Boot()
+*/
+func OpenGpioChip(path string) (GpioChip, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gpio chip %s: %w", path, err)
+	}
+	return &charDevChip{f: f}, nil
+}
+
+// gpioeventRequest : struct gpioevent_request
+type gpioeventRequest struct {
+	lineOffset  uint32
+	handleFlags uint32
+	eventFlags  uint32
+	consumer    [32]byte
+	fd          int32
+}
+
+func (cd *charDevChip) RequestEvents(pin string, consumer string) (EventLine, error) {
+	offset, ok := physToBCM[pin]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoLine, pin)
+	}
+	req := gpioeventRequest{lineOffset: offset, handleFlags: GPIOHANDLE_REQUEST_INPUT, eventFlags: GPIOEVENT_REQUEST_BOTH_EDGES}
+	copy(req.consumer[:len(req.consumer)-1], consumer)
+	if err := ioctl(cd.f.Fd(), GPIO_GET_LINEEVENT_IOCTL, unsafe.Pointer(&req)); err != nil {
+		return nil, fmt.Errorf("failed to request events on line %d: %w", offset, err)
+	}
+	// non blocking fd goes on the runtime poller, so that closing the line unblocks a pending read
+	if err := syscall.SetNonblock(int(req.fd), true); err != nil {
+		syscall.Close(int(req.fd))
+		return nil, err
+	}
+	return &charDevLine{File: os.NewFile(uintptr(req.fd), fmt.Sprintf("gpio-line-%d", offset))}, nil
+}
+
+// charDevLine : line fd from the character device
+type charDevLine struct {
+	*os.File
+}
+
+func (cl *charDevLine) Value() (bool, error) {
+	var data [64]byte // struct gpiohandle_data
+	conn, err := cl.File.SyscallConn()
+	if err != nil {
+		return false, err
+	}
+	var ioErr error
+	if err := conn.Control(func(fd uintptr) {
+		ioErr = ioctl(fd, GPIOHANDLE_GET_LINE_VALUES_IOCTL, unsafe.Pointer(&data))
+	}); err != nil {
+		return false, err
+	}
+	return data[0] == 1, ioErr
+}
+
+func ioctl(fd uintptr, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// eventTime : kernel time stamps the events on the monotonic clock, older kernels on the real time clock
+func eventTime(ns uint64) time.Time {
+	now := time.Now()
+	if d := now.Sub(time.Unix(0, int64(ns))); d > -24*time.Hour && d < 24*time.Hour {
+		return time.Unix(0, int64(ns))
+	}
+	var ts syscall.Timespec
+	if _, _, errno := syscall.Syscall(syscall.SYS_CLOCK_GETTIME, 1, uintptr(unsafe.Pointer(&ts)), 0); errno != 0 {
+		return now // CLOCK_MONOTONIC is always there, but then time of reading is close enough
+	}
+	return now.Add(-time.Duration(ts.Nano() - int64(ns)))
+}
+
+// decodeEdge : one gpioevent_data record to an edge
+func decodeEdge(rec []byte) (Edge, bool) {
+	switch binary.LittleEndian.Uint32(rec[8:12]) {
+	case GPIOEVENT_EVENT_RISING_EDGE:
+		return Edge{Rising: true, At: eventTime(binary.LittleEndian.Uint64(rec[0:8]))}, true
+	case GPIOEVENT_EVENT_FALLING_EDGE:
+		return Edge{Rising: false, At: eventTime(binary.LittleEndian.Uint64(rec[0:8]))}, true
+	}
+	return Edge{}, false
+}
+
+// WatchEdges : sends out the edges on the line as they come in, till the context is done
+// line is closed when done, which is also what unblocks the pending read
+func WatchEdges(line EventLine, ctx context.Context, wg *sync.WaitGroup) chan Edge {
+	edges := make(chan Edge, 10)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		line.Close()
+	}()
+	go func() {
+		defer logrus.Warn("Now closing gpio line events..")
+		defer wg.Done()
+		defer close(edges)
+		rec := make([]byte, EVENT_SIZE)
+		for {
+			if _, err := io.ReadFull(line, rec); err != nil {
+				if ctx.Err() == nil {
+					logrus.Errorf("gpio line events stopped: %s", err)
+				}
+				return
+			}
+			edge, ok := decodeEdge(rec)
+			if !ok {
+				continue
+			}
+			select {
+			case edges <- edge:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return edges
+}
+
+// feedEdges : drives the press detector from the line edges instead of polling
+// detector is ticked only while a gesture is in progress, since gestures complete with the passage of time
+// invert is for inputs that are pressed when the line is low, emit returns false when the listener is gone
+func feedEdges(edges chan Edge, level, invert bool, detector *PressDetector, tick time.Duration, ctx context.Context, emit func(PressEvent) bool) {
+	last := time.Now()
+	feed := func(lvl bool, at time.Time) bool {
+		if at.Before(last) {
+			at = last // edge could have queued behind a tick
+		}
+		last = at
+		for _, evt := range detector.Feed(lvl, at) {
+			if !emit(evt) {
+				return false
+			}
+		}
+		return true
+	}
+	level = level != invert
+	if !feed(level, last) {
+		return
+	}
+	for {
+		var ticks <-chan time.Time
+		if !detector.Idle() {
+			ticks = time.After(tick)
+		}
+		select {
+		case e, ok := <-edges:
+			if !ok {
+				return
+			}
+			// level held till the edge, for the debounce to see how long it was held
+			if !feed(level, e.At) {
+				return
+			}
+			level = e.Rising != invert
+			if !feed(level, e.At) {
+				return
+			}
+		case <-ticks:
+			if !feed(level, time.Now()) {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package digital
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeChip : stands in for the gpio character device, edges are written in as kernel event records over a pipe
+type fakeChip struct {
+	lines map[string]*fakeLine
+	err   error
+}
+
+type fakeLine struct {
+	*os.File          // read end, as the line fd
+	w        *os.File // write end, test writes the events
+	level    bool
+}
+
+func newFakeChip() *fakeChip {
+	return &fakeChip{lines: map[string]*fakeLine{}}
+}
+
+func (fc *fakeChip) RequestEvents(pin string, consumer string) (EventLine, error) {
+	if fc.err != nil {
+		return nil, fc.err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	fl := &fakeLine{File: r, w: w}
+	fc.lines[pin] = fl
+	return fl, nil
+}
+
+func (fl *fakeLine) Value() (bool, error) {
+	return fl.level, nil
+}
+
+// edge : writes one gpioevent_data record the way the kernel would
+func (fl *fakeLine) edge(rising bool, at time.Time) {
+	rec := make([]byte, EVENT_SIZE)
+	binary.LittleEndian.PutUint64(rec[0:8], uint64(at.UnixNano()))
+	id := uint32(GPIOEVENT_EVENT_FALLING_EDGE)
+	if rising {
+		id = GPIOEVENT_EVENT_RISING_EDGE
+	}
+	binary.LittleEndian.PutUint32(rec[8:12], id)
+	fl.w.Write(rec)
+}
+
+func TestDecodeEdge(t *testing.T) {
+	at := time.Now().Add(-time.Second)
+	rec := make([]byte, EVENT_SIZE)
+	binary.LittleEndian.PutUint64(rec[0:8], uint64(at.UnixNano()))
+	binary.LittleEndian.PutUint32(rec[8:12], GPIOEVENT_EVENT_RISING_EDGE)
+	e, ok := decodeEdge(rec)
+	assert.True(t, ok)
+	assert.True(t, e.Rising)
+	assert.True(t, e.At.Equal(time.Unix(0, at.UnixNano())), "real time stamps are taken as is")
+
+	binary.LittleEndian.PutUint32(rec[8:12], 0x07)
+	_, ok = decodeEdge(rec)
+	assert.False(t, ok, "unknown event ids are dropped")
+}
+
+func TestTouchGesturesFromEdges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	chip := newFakeChip()
+	adp := newFakeAdaptor()
+	ts := NewTouchSensor("31", adp).WithChip(chip).Boot()
+	assert.Equal(t, 0, adp.writes, "pin is not touched through sysfs when on the chip")
+	gestures := ts.Gestures(GESTURE_WATCH, DEFAULT_GESTURES, ctx, &wg)
+
+	line := chip.lines["31"]
+	if assert.NotNil(t, line) {
+		start := time.Now()
+		line.edge(true, start)
+		time.Sleep(150 * time.Millisecond)
+		line.edge(false, start.Add(150*time.Millisecond))
+	}
+	kinds := []PressKind{}
+	timeout := time.After(2 * time.Second)
+	for len(kinds) < 3 {
+		select {
+		case g := <-gestures:
+			kinds = append(kinds, g.Kind)
+		case <-timeout:
+			t.Fatalf("gestures did not complete, got %v", kinds)
+		}
+	}
+	assert.Equal(t, []PressKind{PRESS, RELEASE, SHORT_PRESS}, kinds)
+	cancel()
+	wg.Wait()
+}
+
+func TestButtonFallsBackToPolling(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	chip := newFakeChip()
+	chip.err = errors.New("device or resource busy")
+	adp := newFakeAdaptor()
+	btn := NewInterruptButton("33", BTN_PULLUP, adp).WithChip(chip)
+	events := btn.Start(BTN_POLL, ctx, &wg)
+	adp.DigitalWrite("33", 1)
+	select {
+	case evt := <-events:
+		assert.Equal(t, PRESS, evt.Kind)
+	case <-time.After(time.Second):
+		t.Fatal("polling did not pick up the press")
+	}
+	cancel()
+	wg.Wait()
+}
@@ -0,0 +1,55 @@
+package digital
+
+import "sync"
+
+// fakeAdaptor : stands in for the raspi adaptor, pins are just levels in a map
+type fakeAdaptor struct {
+	mu     sync.Mutex
+	levels map[string]int
+	writes int
+	fail   error // writes fail with this when set
+}
+
+func newFakeAdaptor() *fakeAdaptor {
+	return &fakeAdaptor{levels: map[string]int{}}
+}
+
+func (fa *fakeAdaptor) Name() string     { return "fake" }
+func (fa *fakeAdaptor) SetName(n string) {}
+func (fa *fakeAdaptor) Connect() error   { return nil }
+func (fa *fakeAdaptor) Finalize() error  { return nil }
+
+func (fa *fakeAdaptor) DigitalWrite(pin string, level byte) error {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	if fa.fail != nil {
+		return fa.fail
+	}
+	fa.levels[pin] = int(level)
+	fa.writes++
+	return nil
+}
+
+func (fa *fakeAdaptor) DigitalRead(pin string) (int, error) {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	return fa.levels[pin], nil
+}
+
+func (fa *fakeAdaptor) level(pin string) int {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	return fa.levels[pin]
+}
+
+func (fa *fakeAdaptor) set(pin string, level int) {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	fa.levels[pin] = level
+}
+
+func (fa *fakeAdaptor) failWrites(err error) {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	fa.fail = err
+}
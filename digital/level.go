@@ -0,0 +1,196 @@
+package digital
+
+/* ====================
+Water level in the fish tank, 2 ways to sense it
+- Float switches : reed switch in a float, closes when the water reaches it. Cheap and dependable, but just a yes/no at one height
+- HC-SR04 ultrasonic : mounted above the tank looking down, distance to the water surface gives the level continuously
+Ripples from the inflow make both jittery, hence float switches are debounced over seconds and ultrasonic readings are the median of a few pings.
+==================== */
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gobot.io/x/gobot"
+	"gobot.io/x/gobot/drivers/gpio"
+)
+
+const (
+	FLOAT_WATCH    = 200 * time.Millisecond // float switch sampling
+	FLOAT_DEBOUNCE = 3 * time.Second        // ripples can toggle the float for a second or two
+	SOUND_CMPS     = 34300.0                // speed of sound in cm/s at ~20°C
+	ECHO_TIMEOUT   = 30 * time.Millisecond  // beyond ~5m, or no echo at all
+	PING_GAP       = 60 * time.Millisecond  // datasheet recommends atleast 60ms between pings
+)
+
+var (
+	ErrNoEcho = errors.New("hc-sr04 echo timed out")
+)
+
+// FloatSwitch : float switch on a digital pin
+type FloatSwitch struct {
+	*gpio.DirectPinDriver
+	activeLow bool // true when the switch pulls the pin low as the water reaches it
+	mu        sync.Mutex
+	wet       bool // debounced state, true when the water is at or above the float
+}
+
+// NewFloatSwitch : ctor for the float switch
+// activeLow	: when the switch is wired to ground against a pull up
+func NewFloatSwitch(pin string, activeLow bool, adp gobot.Adaptor) *FloatSwitch {
+	return &FloatSwitch{
+		DirectPinDriver: gpio.NewDirectPinDriver(adp, pin),
+		activeLow:       activeLow,
+	}
+}
+
+// Read : raw state of the switch, true when the water is at or above the float
+func (fs *FloatSwitch) Read() (bool, error) {
+	val, err := fs.DirectPinDriver.DigitalRead()
+	if err != nil {
+		return false, err
+	}
+	return (val == 1) != fs.activeLow, nil
+}
+
+// IsWet : debounced state of the switch as last seen by Watch
+func (fs *FloatSwitch) IsWet() bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.wet
+}
+
+// Watch : samples the switch and sends the debounced state every time it changes, and once to start with
+//
+/*
+	low := digital.NewFloatSwitch("38", true, r)
+	for wet := range low.Watch(digital.FLOAT_WATCH, digital.FLOAT_DEBOUNCE, ctx, &wg) {
+		if !wet {
+			log.Warn("fish tank water below the low float")
+		}
+	}
+*/
+func (fs *FloatSwitch) Watch(speed, debounce time.Duration, ctx context.Context, wg *sync.WaitGroup) chan bool {
+	states := make(chan bool, 1)
+	wg.Add(1)
+	go func() {
+		defer logrus.Warn("Now closing float switch..")
+		defer wg.Done()
+		defer close(states)
+		known := false // debounced state is not known till the switch is stable for once
+		var raw bool
+		var rawSince time.Time
+		for {
+			select {
+			case <-time.After(speed):
+				wet, err := fs.Read()
+				if err != nil {
+					continue
+				}
+				now := time.Now()
+				if wet != raw || rawSince.IsZero() {
+					raw, rawSince = wet, now
+				}
+				if now.Sub(rawSince) < debounce || (known && raw == fs.IsWet()) {
+					continue
+				}
+				known = true
+				fs.mu.Lock()
+				fs.wet = raw
+				fs.mu.Unlock()
+				select {
+				case <-states: // only the latest state matters
+				default:
+				}
+				states <- raw
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return states
+}
+
+// HCSR04 : ultrasonic distance sensor, trigger & echo on 2 digital pins
+// echo pin is 5V on the sensor, it has to come in through a divider
+type HCSR04 struct {
+	trig *gpio.DirectPinDriver
+	echo *gpio.DirectPinDriver
+	mu   sync.Mutex
+}
+
+// NewHCSR04 : ctor for the ultrasonic sensor
+//
+/*
+	us := digital.NewHCSR04("16", "18", r)
+	cm, err := us.Distance(5)
+*/
+func NewHCSR04(trig, echo string, adp gobot.Adaptor) *HCSR04 {
+	return &HCSR04{
+		trig: gpio.NewDirectPinDriver(adp, trig),
+		echo: gpio.NewDirectPinDriver(adp, echo),
+	}
+}
+
+// ping : single measurement in cm
+func (us *HCSR04) ping() (float64, error) {
+	if err := us.trig.DigitalWrite(1); err != nil {
+		return 0, err
+	}
+	time.Sleep(10 * time.Microsecond)
+	if err := us.trig.DigitalWrite(0); err != nil {
+		return 0, err
+	}
+	wait := func(level int) (time.Time, error) {
+		deadline := time.Now().Add(ECHO_TIMEOUT)
+		for time.Now().Before(deadline) {
+			val, err := us.echo.DigitalRead()
+			if err != nil {
+				return time.Time{}, err
+			}
+			if val == level {
+				return time.Now(), nil
+			}
+		}
+		return time.Time{}, ErrNoEcho
+	}
+	start, err := wait(1)
+	if err != nil {
+		return 0, err
+	}
+	end, err := wait(0)
+	if err != nil {
+		return 0, err
+	}
+	return end.Sub(start).Seconds() * SOUND_CMPS / 2, nil
+}
+
+// Distance : median of the pings in cm, pings that fail are skipped
+func (us *HCSR04) Distance(pings int) (float64, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if pings <= 0 {
+		pings = 1
+	}
+	dists := []float64{}
+	var lastErr error
+	for i := 0; i < pings; i++ {
+		if i > 0 {
+			time.Sleep(PING_GAP)
+		}
+		d, err := us.ping()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		dists = append(dists, d)
+	}
+	if len(dists) == 0 {
+		return 0, lastErr
+	}
+	sort.Float64s(dists)
+	return dists[len(dists)/2], nil
+}
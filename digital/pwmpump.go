@@ -0,0 +1,149 @@
+package digital
+
+/* ====================
+Variable speed DC pumps driven by PWM, either from the PWM pin on the SoC (raspi adaptor, needs pi-blaster) or from an external PWM controller like the PCA9685.
+Siphon in the growbed needs high inflow to lock and minimal inflow while draining - a square wave. Hard switching the pump is a crude approximation of it, with speed control the inflow can be shaped directly.
+Pump has 2 preset levels - flood & drain - that the schedule flips between, though any level can be set.
+==================== */
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gobot.io/x/gobot/drivers/gpio"
+)
+
+const (
+	PWM_KICK = 300 * time.Millisecond // full duty at start from standstill, to get the motor past stall
+)
+
+// PwmPump : DC pump with speed control, level is the duty cycle in percent
+type PwmPump struct {
+	out      gpio.PwmWriter
+	pin      string
+	mu       sync.Mutex
+	level    float64 // current duty in percent
+	flood    float64 // duty while flooding the growbed
+	drain    float64 // duty while the siphon drains the growbed
+	minDuty  float64 // motor stalls below this duty, non zero levels are raised to this
+	flooding bool
+}
+
+// NewPwmPump : ctor for the pump
+// pin		: PWM pin on the SoC, or the channel on the PWM controller
+// out		: raspi adaptor or PCA9685 driver, anything that can write PWM to a pin
+//
+/*
+	// on the SoC PWM pin
+	pp := digital.NewPwmPump("12", r).WithLevels(100, 20, 15).Boot()
+	// on channel 0 of PCA9685
+	pca := i2c.NewPCA9685Driver(r)
+	pca.Start()
+	pp := digital.NewPwmPump("0", pca).WithLevels(100, 20, 15).Boot()
+	pp.Flood()
+*/
+func NewPwmPump(pin string, out gpio.PwmWriter) *PwmPump {
+	return &PwmPump{
+		out:   out,
+		pin:   pin,
+		flood: 100,
+	}
+}
+
+// WithLevels : preset levels for flooding & draining, and the minimum duty below which the motor stalls
+// all values are percent of full speed
+func (pp *PwmPump) WithLevels(flood, drain, minDuty float64) *PwmPump {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	pp.flood, pp.drain, pp.minDuty = flood, drain, minDuty
+	return pp
+}
+
+// Boot : call this immediately after constructor, pump is stopped to start with
+func (pp *PwmPump) Boot() *PwmPump {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	pp.write(0)
+	pp.flooding = false
+	return pp
+}
+
+// ShutD : stops the pump
+func (pp *PwmPump) ShutD() error {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	pp.flooding = false
+	return pp.write(0)
+}
+
+// Level : current duty in percent
+func (pp *PwmPump) Level() float64 {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	return pp.level
+}
+
+// IsFlooding : true when the pump was last set to the flood level
+func (pp *PwmPump) IsFlooding() bool {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	return pp.flooding
+}
+
+// SetLevel : runs the pump at the duty in percent, 0 stops the pump
+func (pp *PwmPump) SetLevel(pct float64) error {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	return pp.set(pct)
+}
+
+// Flood : runs the pump at the flood level
+func (pp *PwmPump) Flood() error {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	pp.flooding = true
+	return pp.set(pp.flood)
+}
+
+// Drain : runs the pump at the drain level
+func (pp *PwmPump) Drain() error {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	pp.flooding = false
+	return pp.set(pp.drain)
+}
+
+// Toggle : flips between flood & drain levels, this is what the schedule ticks call
+func (pp *PwmPump) Toggle() error {
+	if pp.IsFlooding() {
+		return pp.Drain()
+	}
+	return pp.Flood()
+}
+
+// set : call with the lock held
+func (pp *PwmPump) set(pct float64) error {
+	if pct < 0 || pct > 100 {
+		return fmt.Errorf("invalid pump level %.1f, expected 0-100", pct)
+	}
+	if pct > 0 && pct < pp.minDuty {
+		pct = pp.minDuty
+	}
+	if pp.level == 0 && pct > 0 && pct < 100 {
+		// from standstill the motor needs a kick to start turning at low duty
+		if err := pp.write(100); err != nil {
+			return err
+		}
+		time.Sleep(PWM_KICK)
+	}
+	return pp.write(pct)
+}
+
+// write : call with the lock held
+func (pp *PwmPump) write(pct float64) error {
+	if err := pp.out.PwmWrite(pp.pin, byte(pct*255/100+0.5)); err != nil {
+		return fmt.Errorf("failed to set pump level on pin %s: %w", pp.pin, err)
+	}
+	pp.level = pct
+	return nil
+}
@@ -0,0 +1,70 @@
+package digital
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePwm : records the duty bytes written to the pins
+type fakePwm struct {
+	mu     sync.Mutex
+	writes []byte
+}
+
+func (fp *fakePwm) PwmWrite(pin string, level byte) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	fp.writes = append(fp.writes, level)
+	return nil
+}
+
+// taken : writes so far, cleared for the next step of the test
+func (fp *fakePwm) taken() []byte {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	w := fp.writes
+	fp.writes = nil
+	return w
+}
+
+func TestPwmPumpLevels(t *testing.T) {
+	fp := &fakePwm{}
+	pp := NewPwmPump("12", fp).WithLevels(100, 40, 15).Boot()
+	assert.Equal(t, []byte{0}, fp.taken(), "pump is stopped on boot")
+
+	assert.Nil(t, pp.Flood())
+	assert.Equal(t, []byte{255}, fp.taken(), "full speed needs no kick")
+	assert.True(t, pp.IsFlooding())
+
+	assert.Nil(t, pp.Toggle())
+	assert.Equal(t, []byte{102}, fp.taken(), "40% of 255, rounded")
+	assert.Equal(t, 40.0, pp.Level())
+	assert.False(t, pp.IsFlooding())
+
+	assert.Nil(t, pp.SetLevel(50))
+	assert.Equal(t, []byte{128}, fp.taken(), "no kick while the motor is turning")
+	assert.NotNil(t, pp.SetLevel(120), "beyond full speed")
+	assert.Empty(t, fp.taken())
+
+	assert.Nil(t, pp.ShutD())
+	assert.Equal(t, []byte{0}, fp.taken())
+}
+
+func TestPwmPumpKick(t *testing.T) {
+	fp := &fakePwm{}
+	pp := NewPwmPump("12", fp).WithLevels(100, 20, 15).Boot()
+	fp.taken()
+
+	start := time.Now()
+	assert.Nil(t, pp.Drain())
+	assert.GreaterOrEqual(t, time.Since(start), PWM_KICK, "kick is held before the level is set")
+	assert.Equal(t, []byte{255, 51}, fp.taken(), "full duty from standstill, then the drain level")
+
+	assert.Nil(t, pp.SetLevel(0))
+	assert.Nil(t, pp.SetLevel(5))
+	assert.Equal(t, []byte{0, 255, 38}, fp.taken(), "level below the min duty is raised to it, 15% of 255")
+	assert.Equal(t, 15.0, pp.Level())
+}
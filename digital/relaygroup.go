@@ -0,0 +1,181 @@
+package digital
+
+/* ====================
+Once the drain valve and the fill pump run together, a scheduling mistake must not be able to open both.
+RelayGroup is a guard over a set of relays that enforces interlocks across them, such as
+- at most one of these relays is on
+- B may only be on while A is on
+- no 2 relays in the group switch within a minimum gap of each other
+Every switch of a grouped relay is vetted by the group before the pin is written, no matter who asks for the switch.
+==================== */
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInterlock = errors.New("relay interlock violated")
+)
+
+// RelayGroup : interlocks across a set of relays, relays are known by their names
+type RelayGroup struct {
+	mu       sync.Mutex
+	relays   map[string]*RelaySwitch
+	states   map[string]bool
+	onlyOne  [][]string          // sets of relays of which at most one can be on
+	requires map[string][]string // relay -> relays that have to be on for it to be on
+	gap      time.Duration       // minimum time between switches of any 2 relays in the group
+	last     time.Time           // time of the last switch in the group
+	lastBy   string              // relay that switched last
+	held     string              // relay whose switch is allowed but not settled yet
+	heldLast time.Time           // last & lastBy from before the held switch, put back if it does not go through
+	heldBy   string
+	now      func() time.Time
+}
+
+// NewRelayGroup : groups the relays, relays are known by their names and hence need unique names
+// relays are guarded by the group from here on
+//
+/*
+	fill := digital.NewRelaySwitch("35", false, r)
+	fill.SetName("pump")
+	drain := digital.NewRelaySwitch("37", false, r)
+	drain.SetName("drain")
+	grp, err := digital.NewRelayGroup(fill, drain)
+	grp.AtMostOne("pump", "drain").MinGap(500 * time.Millisecond)
+	fill.Boot()
+	drain.Boot()
+	drain.High() // ok
+	fill.High()  // ErrInterlock, drain is open
+*/
+func NewRelayGroup(relays ...*RelaySwitch) (*RelayGroup, error) {
+	grp := &RelayGroup{
+		relays:   map[string]*RelaySwitch{},
+		states:   map[string]bool{},
+		requires: map[string][]string{},
+		now:      time.Now,
+	}
+	for _, rs := range relays {
+		if _, ok := grp.relays[rs.Name()]; ok {
+			return nil, fmt.Errorf("duplicate relay name in group: %s", rs.Name())
+		}
+		grp.relays[rs.Name()] = rs
+		grp.states[rs.Name()] = rs.IsHigh()
+	}
+	for _, rs := range relays {
+		rs.Guard(grp)
+	}
+	return grp, nil
+}
+
+// AtMostOne : of the named relays at most one can be on at any time
+func (grp *RelayGroup) AtMostOne(names ...string) *RelayGroup {
+	grp.mu.Lock()
+	defer grp.mu.Unlock()
+	grp.onlyOne = append(grp.onlyOne, names)
+	return grp
+}
+
+// Requires : relay can be on only while the other relay is on
+// other relay cannot be switched off while this one is on
+func (grp *RelayGroup) Requires(name, other string) *RelayGroup {
+	grp.mu.Lock()
+	defer grp.mu.Unlock()
+	grp.requires[name] = append(grp.requires[name], other)
+	return grp
+}
+
+// MinGap : no 2 relays in the group can switch within the gap of each other
+func (grp *RelayGroup) MinGap(d time.Duration) *RelayGroup {
+	grp.mu.Lock()
+	defer grp.mu.Unlock()
+	grp.gap = d
+	return grp
+}
+
+// States : last known state of all the relays in the group
+func (grp *RelayGroup) States() map[string]bool {
+	grp.mu.Lock()
+	defer grp.mu.Unlock()
+	states := make(map[string]bool, len(grp.states))
+	for name, on := range grp.states {
+		states[name] = on
+	}
+	return states
+}
+
+// Relay : relay in the group by name, nil if not found
+func (grp *RelayGroup) Relay(name string) *RelaySwitch {
+	return grp.relays[name]
+}
+
+// Allow : implements Guard, vets the switch against all the interlocks
+func (grp *RelayGroup) Allow(name string, on bool) error {
+	grp.mu.Lock()
+	defer grp.mu.Unlock()
+	if _, ok := grp.states[name]; !ok {
+		return nil // not a relay from this group
+	}
+	now := grp.now()
+	if grp.gap > 0 && !grp.last.IsZero() && grp.lastBy != name {
+		if since := now.Sub(grp.last); since < grp.gap {
+			return fmt.Errorf("%w: %s switched %s ago, minimum gap is %s", ErrInterlock, grp.lastBy, since.Round(time.Millisecond), grp.gap)
+		}
+	}
+	if on {
+		for _, set := range grp.onlyOne {
+			if !contains(set, name) {
+				continue
+			}
+			for _, other := range set {
+				if other != name && grp.states[other] {
+					return fmt.Errorf("%w: %s cannot be on while %s is on", ErrInterlock, name, other)
+				}
+			}
+		}
+		for _, other := range grp.requires[name] {
+			if !grp.states[other] {
+				return fmt.Errorf("%w: %s can be on only while %s is on", ErrInterlock, name, other)
+			}
+		}
+	} else {
+		for dependent, others := range grp.requires {
+			if contains(others, name) && grp.states[dependent] {
+				return fmt.Errorf("%w: %s cannot be off while %s is on", ErrInterlock, name, dependent)
+			}
+		}
+	}
+	// allowed switch is reserved so that 2 relays switching together cannot both get through
+	grp.held, grp.heldLast, grp.heldBy = name, grp.last, grp.lastBy
+	grp.states[name] = on
+	grp.last, grp.lastBy = now, name
+	return nil
+}
+
+// Settle : implements Guard, records the state of the relay after the pin was written
+// reserved switch that did not go through does not hold up the other relays for the gap
+func (grp *RelayGroup) Settle(name string, on bool) {
+	grp.mu.Lock()
+	defer grp.mu.Unlock()
+	if _, ok := grp.states[name]; !ok {
+		return
+	}
+	if grp.held == name {
+		if grp.states[name] != on {
+			grp.last, grp.lastBy = grp.heldLast, grp.heldBy
+		}
+		grp.held = ""
+	}
+	grp.states[name] = on
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
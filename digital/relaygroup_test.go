@@ -0,0 +1,93 @@
+package digital
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newNamedRelay(name, pin string, fa *fakeAdaptor) *RelaySwitch {
+	rs := NewRelaySwitch(pin, false, fa)
+	rs.SetName(name)
+	return rs
+}
+
+func TestRelayGroupInterlocks(t *testing.T) {
+	fa := newFakeAdaptor()
+	pump := newNamedRelay("pump", "35", fa)
+	drain := newNamedRelay("drain", "37", fa)
+	aerator := newNamedRelay("aerator", "38", fa)
+	grp, err := NewRelayGroup(pump, drain, aerator)
+	assert.Nil(t, err)
+	grp.AtMostOne("pump", "drain").Requires("aerator", "pump")
+
+	assert.Nil(t, drain.High())
+	err = pump.High()
+	assert.True(t, errors.Is(err, ErrInterlock), "Unexpected error %v", err)
+	assert.Equal(t, 0, fa.level("35"), "rejected relay pin should not have been written")
+
+	err = aerator.High()
+	assert.True(t, errors.Is(err, ErrInterlock), "aerator cannot be on without the pump: %v", err)
+
+	assert.Nil(t, drain.Low())
+	assert.Nil(t, pump.High())
+	assert.Nil(t, aerator.High())
+	err = pump.Low()
+	assert.True(t, errors.Is(err, ErrInterlock), "pump cannot be off while aerator is on: %v", err)
+	assert.Equal(t, 1, fa.level("35"))
+
+	assert.Nil(t, aerator.Low())
+	assert.Nil(t, pump.Low())
+	assert.Equal(t, map[string]bool{"pump": false, "drain": false, "aerator": false}, grp.States())
+
+	_, err = NewRelayGroup(pump, newNamedRelay("pump", "40", fa))
+	assert.NotNil(t, err, "duplicate names cannot be grouped")
+}
+
+func TestRelayGroupGap(t *testing.T) {
+	fa := newFakeAdaptor()
+	pump := newNamedRelay("pump", "35", fa)
+	drain := newNamedRelay("drain", "37", fa)
+	grp, _ := NewRelayGroup(pump, drain)
+	grp.MinGap(100 * time.Millisecond)
+
+	assert.Nil(t, pump.High())
+	err := drain.High()
+	assert.True(t, errors.Is(err, ErrInterlock), "Unexpected error %v", err)
+	time.Sleep(150 * time.Millisecond)
+	assert.Nil(t, drain.High())
+}
+
+// vetoGuard : rejects every switch on, as a guard after the group would
+type vetoGuard struct{}
+
+func (vetoGuard) Allow(name string, on bool) error {
+	if on {
+		return errors.New("veto")
+	}
+	return nil
+}
+
+func (vetoGuard) Settle(name string, on bool) {}
+
+func TestRelayGroupGapRejected(t *testing.T) {
+	fa := newFakeAdaptor()
+	pump := newNamedRelay("pump", "35", fa)
+	drain := newNamedRelay("drain", "37", fa)
+	grp, _ := NewRelayGroup(pump, drain)
+	grp.MinGap(time.Minute)
+	pump.Guard(vetoGuard{})
+
+	assert.NotNil(t, pump.High(), "later guard rejects the switch")
+	assert.False(t, pump.IsHigh())
+	assert.Nil(t, drain.High(), "switch that never happened does not hold up the group")
+
+	fa.failWrites(errors.New("bus"))
+	assert.ErrorIs(t, drain.Low(), ErrWrite)
+	fa.failWrites(nil)
+	assert.True(t, drain.IsHigh())
+	assert.ErrorIs(t, pump.High(), ErrInterlock, "failed write puts back the switch of drain that did go through")
+	assert.Equal(t, map[string]bool{"pump": false, "drain": true}, grp.States())
+}
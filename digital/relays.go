@@ -9,14 +9,51 @@ When working with relays its st fwd that we choose the gobot drivers available.
 Here we develop a thick wrapper around gpio.DirecPinDriver which can substitute RelayDriver.
 Testing platform with Raspberry Pi Zero W rev 1.1, BCM2835
 
+Dwell limits are enforced here in the driver, so no caller can chatter the contacts.
 ==================== */
 import (
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
+	"github.com/sirupsen/logrus"
 	"gobot.io/x/gobot"
 	"gobot.io/x/gobot/drivers/gpio"
 )
 
+var (
+	ErrMinOnTime  = errors.New("relay has not been on for the minimum on-time")
+	ErrMinOffTime = errors.New("relay has not been off for the minimum off-time")
+	ErrSwitchRate = errors.New("relay has exceeded maximum switches per hour")
+	ErrVerify     = errors.New("relay feedback does not match the commanded state")
+	ErrWrite      = errors.New("failed to write the relay pin")
+	ErrDeferred   = errors.New("relay switch queued till the dwell limits allow")
+)
+
+const (
+	RELAY_SETTLE = 50 * time.Millisecond // time for the contacts to settle before the feedback is read
+)
+
+// Guard : vets every switch of the relay before the pin is written
+// Guards are called with the relay locked, they must not call back into the relay
+type Guard interface {
+	// Allow : error when the relay cannot switch to the state, nil otherwise
+	// an allowed switch is as good as done for the guard till it is settled
+	Allow(name string, on bool) error
+	// Settle : state of the relay after the pin was written (or failed to)
+	Settle(name string, on bool)
+}
+
+// DwellLimits : protective limits on how often the relay can switch
+// Zero values disable the corresponding limit.
+type DwellLimits struct {
+	MinOn      time.Duration // relay once closed has to stay closed atleast this long
+	MinOff     time.Duration // relay once opened has to stay open atleast this long
+	MaxPerHour int           // maximum switches in any sliding window of 1 hour
+	Queue      bool          // when true violating requests are deferred till allowed, else rejected
+}
+
 // RelaySwitch : for purposes of simple relay operations, this encapsulates DirectPinDriver
 // gobot package does provide a similar datatype but found that to be unreliable
 type RelaySwitch struct {
@@ -24,6 +61,18 @@ type RelaySwitch struct {
 	Inverted bool
 	state    bool // state of the pin
 
+	mu       sync.Mutex
+	limits   DwellLimits
+	switched time.Time   // time of the last switch, zero when not switched since boot
+	history  []time.Time // switch times within the last hour
+	pending  *time.Timer // deferred switch when the limits are queuing requests
+	pendOn   bool        // state the pending switch would set
+	stats    RelayStats  // cumulative usage of the relay
+	feedback *gpio.DirectPinDriver
+	report   func(error) // verification result after every write
+	written  bool        // pin was written since the lock was taken, verified once the lock is let go
+	guards   []Guard
+	now      func() time.Time
 }
 
 // NewRelaySwitch : ctor for relay wrapper.
@@ -39,15 +88,63 @@ func NewRelaySwitch(pin string, invrtd bool, conn gobot.Adaptor) *RelaySwitch {
 	return &RelaySwitch{
 		DirectPinDriver: gpio.NewDirectPinDriver(conn, pin),
 		Inverted:        invrtd,
+		now:             time.Now,
 	}
 
 }
 
+// WithLimits : sets the dwell limits for the relay, call before Boot
+//
+/*
+	rs := digital.NewRelaySwitch("35", false, r).WithLimits(digital.DwellLimits{
+		MinOn:      30 * time.Second,
+		MinOff:     30 * time.Second,
+		MaxPerHour: 20,
+		Queue:      true,
+	}).Boot()
+*/
+func (rs *RelaySwitch) WithLimits(lim DwellLimits) *RelaySwitch {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.limits = lim
+	return rs
+}
+
+// WithFeedback : verifies every switch against a feedback input, call before Boot
+// feedback pin is wired to sense the switched side of the relay (opto-isolated), and reads high when the relay is closed
+// report is called after every write, with nil when the relay switched as commanded and the error otherwise
+// report is called once the relay is unlocked, feedback is read only after the contacts settle
+func (rs *RelaySwitch) WithFeedback(pin string, report func(error)) *RelaySwitch {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.feedback = gpio.NewDirectPinDriver(rs.Connection(), pin)
+	rs.report = report
+	return rs
+}
+
+// Guard : adds a guard that vets every switch of the relay
+func (rs *RelaySwitch) Guard(g Guard) *RelaySwitch {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.guards = append(rs.guards, g)
+	return rs
+}
+
 // Boot : call this immediately after constructor.
 // will set the pin to low - for inverted relays will set the pin to high
 // copy the pin state back onto the field
+// Boot does not count as a switch and is not subject to dwell limits
 func (rs *RelaySwitch) Boot() *RelaySwitch {
-	rs.Low()
+	rs.locked(func() error {
+		err := rs.write(false)
+		if rs.stats.LastOn.After(rs.stats.LastOff) {
+			// relay was on when the previous run went down, boot has now opened it
+			// saved on-time already includes the spell till the last save
+			rs.stats.LastOff = rs.now()
+			rs.stats.Switches++
+		}
+		return err
+	})
 	time.Sleep(1 * time.Second)
 	// val, _ := rs.DirectPinDriver.DigitalRead()
 	// rs.state = val == 1 // state is independent of the inversion
@@ -57,43 +154,255 @@ func (rs *RelaySwitch) Boot() *RelaySwitch {
 	return rs
 }
 
+// ShutD : opens the relay bypassing the dwell limits, and drops any pending switch
+// Use this only when the application is going down
+func (rs *RelaySwitch) ShutD() error {
+	return rs.Trip()
+}
+
+// Trip : opens the relay right away bypassing the dwell limits, and drops any pending switch
+// Use this for safety interlocks, that cannot wait on the relay life
+func (rs *RelaySwitch) Trip() error {
+	return rs.locked(func() error {
+		rs.cancelPending()
+		return rs.write(false)
+	})
+}
+
+// Force : switches the relay right away bypassing the dwell limits, and drops any pending switch
+// guards still have their say on switching on, a pump cannot be forced to run dry
+func (rs *RelaySwitch) Force(on bool) error {
+	if !on {
+		return rs.Trip()
+	}
+	return rs.locked(func() error {
+		rs.cancelPending()
+		if on == rs.state {
+			return nil
+		}
+		if err := rs.vet(on); err != nil {
+			return err
+		}
+		return rs.write(on)
+	})
+}
+
 // IsHigh : returns the internal state of RelaySwitch
 // This is always in sync with actual pin state high/low
 func (rs *RelaySwitch) IsHigh() bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
 	return rs.state
 }
 
 // Toggle: sets the relay the opposite of the current state
 // this helps when operating the relay on cron ticks
-func (rs *RelaySwitch) Toggle() {
-	if rs.IsHigh() {
-		rs.Low()
-	} else {
-		rs.High()
-	}
+// When a switch is pending, toggle is relative to the pending state
+// ErrDeferred when the switch is queued for the dwell limits, it is applied later on its own
+func (rs *RelaySwitch) Toggle() error {
+	return rs.locked(func() error {
+		target := rs.state
+		if rs.pending != nil {
+			target = rs.pendOn
+		}
+		return rs.set(!target)
+	})
 }
 
 // Low : Relay switch opens
 // for inverted relays, pin is set to high
+// ErrDeferred when the switch is queued for the dwell limits
 func (rs *RelaySwitch) Low() error {
-	if !rs.Inverted {
-		rs.DirectPinDriver.DigitalWrite(0)
-	} else {
-		rs.DirectPinDriver.DigitalWrite(1)
-	}
-	rs.state = false
-	return nil
+	return rs.locked(func() error { return rs.set(false) })
 }
 
 // High: relay switch closes.
 // for inverted relays the pin set to low
+// ErrDeferred when the switch is queued for the dwell limits
 func (rs *RelaySwitch) High() error {
-	if !rs.Inverted {
-		rs.DirectPinDriver.DigitalWrite(1)
-	} else {
-		rs.DirectPinDriver.DigitalWrite(0)
+	return rs.locked(func() error { return rs.set(true) })
+}
+
+// locked : runs the switch with the relay locked, and verifies the pin if it was written once the lock is let go
+func (rs *RelaySwitch) locked(sw func() error) error {
+	rs.mu.Lock()
+	rs.written = false
+	err := sw()
+	written, on, report := rs.written, rs.state, rs.report
+	rs.mu.Unlock()
+	if errors.Is(err, ErrWrite) && report != nil {
+		report(err)
+	}
+	if err != nil || !written {
+		return err
+	}
+	return rs.verify(on)
+}
+
+// set : checks the dwell limits before switching the relay to the desired state
+// requests that violate the limits are either queued (ErrDeferred) or rejected
+// call this with the lock held
+func (rs *RelaySwitch) set(on bool) error {
+	if on == rs.state {
+		// nothing to switch, any pending switch is now outdated
+		rs.cancelPending()
+		return nil
+	}
+	at, err := rs.allowedAt(on)
+	if err == nil {
+		rs.cancelPending()
+		if err := rs.vet(on); err != nil {
+			return err
+		}
+		return rs.write(on)
+	}
+	if !rs.limits.Queue {
+		return err
+	}
+	rs.cancelPending()
+	rs.pendOn = on
+	var deferred *time.Timer
+	deferred = time.AfterFunc(at.Sub(rs.now()), func() {
+		err := rs.locked(func() error {
+			if rs.pending != deferred {
+				return nil // was cancelled or replaced meanwhile
+			}
+			rs.pending = nil
+			// guards are consulted when the switch is applied, things may have changed since it was queued
+			if err := rs.vet(on); err != nil {
+				return err
+			}
+			return rs.write(on)
+		})
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"pin": rs.Pin(),
+				"on":  on,
+			}).Errorf("failed queued relay switch: %s", err)
+		}
+	})
+	rs.pending = deferred
+	logrus.WithFields(logrus.Fields{
+		"pin":    rs.Pin(),
+		"on":     on,
+		"reason": err,
+		"at":     at.Format(time.RFC822),
+	}).Warn("relay switch queued")
+	return fmt.Errorf("%w, switches at %s: %s", ErrDeferred, at.Format(time.RFC822), err)
+}
+
+// allowedAt : earliest time at which the relay can switch to the desired state
+// error is nil when the switch is allowed right now, else it describes the limit that is violated
+// call this with the lock held
+func (rs *RelaySwitch) allowedAt(on bool) (time.Time, error) {
+	now := rs.now()
+	at := now
+	var err error
+	if !rs.switched.IsZero() {
+		if on && rs.limits.MinOff > 0 {
+			if t := rs.switched.Add(rs.limits.MinOff); t.After(at) {
+				at, err = t, fmt.Errorf("%w (%s), retry after %s", ErrMinOffTime, rs.limits.MinOff, t.Sub(now).Round(time.Second))
+			}
+		} else if !on && rs.limits.MinOn > 0 {
+			if t := rs.switched.Add(rs.limits.MinOn); t.After(at) {
+				at, err = t, fmt.Errorf("%w (%s), retry after %s", ErrMinOnTime, rs.limits.MinOn, t.Sub(now).Round(time.Second))
+			}
+		}
+	}
+	if rs.limits.MaxPerHour > 0 {
+		rs.history = recent(rs.history, now.Add(-time.Hour))
+		if len(rs.history) >= rs.limits.MaxPerHour {
+			// the oldest switch in the window has to age out before the next one
+			if t := rs.history[len(rs.history)-rs.limits.MaxPerHour].Add(time.Hour); t.After(at) {
+				at, err = t, fmt.Errorf("%w (%d), retry after %s", ErrSwitchRate, rs.limits.MaxPerHour, t.Sub(now).Round(time.Second))
+			}
+		}
+	}
+	return at, err
+}
+
+// vet : checks with all the guards if the switch is allowed
+// call this with the lock held
+func (rs *RelaySwitch) vet(on bool) error {
+	for i, g := range rs.guards {
+		if err := g.Allow(rs.Name(), on); err != nil {
+			for _, prev := range rs.guards[:i] {
+				prev.Settle(rs.Name(), rs.state) // releases what the earlier guards allowed
+			}
+			return err
+		}
 	}
-	rs.state = true
 	return nil
+}
 
+// write : sets the pin and records the switch, guards are settled with the resulting state
+// call this with the lock held, from within locked so that the switch is verified
+func (rs *RelaySwitch) write(on bool) error {
+	defer func() {
+		for _, g := range rs.guards {
+			g.Settle(rs.Name(), rs.state)
+		}
+	}()
+	level := byte(0)
+	if on != rs.Inverted {
+		level = 1
+	}
+	if err := rs.DirectPinDriver.DigitalWrite(level); err != nil {
+		return fmt.Errorf("%w: %s", ErrWrite, err)
+	}
+	if on != rs.state {
+		rs.switched = rs.now()
+		// trimmed here too, with no hourly limit allowedAt never gets to it
+		rs.history = recent(append(rs.history, rs.switched), rs.switched.Add(-time.Hour))
+		rs.account(on, rs.switched)
+	}
+	rs.state = on // state follows the pin, even if the feedback disagrees
+	rs.written = true
+	return nil
+}
+
+// verify : reads back the feedback pin if any once the contacts settle, and reports the result
+// call this without the lock, state & stats are not held up for the settle time
+func (rs *RelaySwitch) verify(on bool) error {
+	rs.mu.Lock()
+	feedback, report := rs.feedback, rs.report
+	rs.mu.Unlock()
+	if feedback == nil {
+		if report != nil {
+			report(nil)
+		}
+		return nil
+	}
+	time.Sleep(RELAY_SETTLE)
+	val, err := feedback.DigitalRead()
+	if err != nil {
+		err = fmt.Errorf("%w: failed to read feedback %s", ErrVerify, err)
+	} else if (val == 1) != on {
+		err = fmt.Errorf("%w: commanded on=%t, feedback reads %d", ErrVerify, on, val)
+	}
+	if rs.IsHigh() != on {
+		return nil // switched again meanwhile, that switch is verified on its own
+	}
+	if report != nil {
+		report(err)
+	}
+	return err
+}
+
+// cancelPending : drops the pending switch if any
+// call this with the lock held
+func (rs *RelaySwitch) cancelPending() {
+	if rs.pending != nil {
+		rs.pending.Stop()
+		rs.pending = nil
+	}
+}
+
+// recent : trims the times that are before the cutoff, times are expected in ascending order
+func recent(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
 }
@@ -0,0 +1,132 @@
+package digital
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock : lets the tests move time forward without sleeping
+type fakeClock struct{ t time.Time }
+
+func (fc *fakeClock) now() time.Time          { return fc.t }
+func (fc *fakeClock) advance(d time.Duration) { fc.t = fc.t.Add(d) }
+
+func TestRelayDwellReject(t *testing.T) {
+	fa := newFakeAdaptor()
+	clk := &fakeClock{t: time.Now()}
+	rs := NewRelaySwitch("35", false, fa).WithLimits(DwellLimits{MinOn: 30 * time.Second, MinOff: 20 * time.Second})
+	rs.now = clk.now
+
+	assert.Nil(t, rs.High(), "first switch after boot is not limited")
+	assert.Equal(t, 1, fa.level("35"))
+
+	clk.advance(10 * time.Second)
+	err := rs.Low()
+	assert.True(t, errors.Is(err, ErrMinOnTime), "Unexpected error %v", err)
+	assert.True(t, rs.IsHigh(), "rejected switch should not change state")
+
+	clk.advance(20 * time.Second)
+	assert.Nil(t, rs.Low())
+	assert.Equal(t, 0, fa.level("35"))
+
+	clk.advance(5 * time.Second)
+	err = rs.Toggle()
+	assert.True(t, errors.Is(err, ErrMinOffTime), "Unexpected error %v", err)
+}
+
+func TestRelaySwitchRate(t *testing.T) {
+	fa := newFakeAdaptor()
+	clk := &fakeClock{t: time.Now()}
+	rs := NewRelaySwitch("35", true, fa).WithLimits(DwellLimits{MaxPerHour: 3})
+	rs.now = clk.now
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, rs.Toggle())
+		clk.advance(time.Minute)
+	}
+	err := rs.Toggle()
+	assert.True(t, errors.Is(err, ErrSwitchRate), "Unexpected error %v", err)
+
+	clk.advance(time.Hour)
+	assert.Nil(t, rs.Toggle(), "switches older than an hour should not count")
+}
+
+func TestRelayHistoryUnlimited(t *testing.T) {
+	fa := newFakeAdaptor()
+	clk := &fakeClock{t: time.Now()}
+	rs := NewRelaySwitch("35", false, fa)
+	rs.now = clk.now
+
+	// a day of switching every 10 minutes, with no hourly limit set
+	for i := 0; i < 24*6; i++ {
+		assert.Nil(t, rs.Toggle())
+		clk.advance(10 * time.Minute)
+	}
+	assert.LessOrEqual(t, len(rs.history), 6, "switches older than an hour should not be kept")
+}
+
+func TestRelayDwellQueue(t *testing.T) {
+	fa := newFakeAdaptor()
+	rs := NewRelaySwitch("35", false, fa).WithLimits(DwellLimits{MinOn: 100 * time.Millisecond, Queue: true})
+
+	assert.Nil(t, rs.High())
+	assert.ErrorIs(t, rs.Low(), ErrDeferred, "queued switch is not applied yet")
+	assert.True(t, rs.IsHigh(), "queued switch should not apply before min on-time")
+
+	time.Sleep(200 * time.Millisecond)
+	assert.False(t, rs.IsHigh(), "queued switch should apply after min on-time")
+	assert.Equal(t, 0, fa.level("35"))
+
+	// a request back to the current state drops the pending one
+	assert.Nil(t, rs.High())
+	assert.ErrorIs(t, rs.Low(), ErrDeferred)
+	assert.Nil(t, rs.High())
+	time.Sleep(200 * time.Millisecond)
+	assert.True(t, rs.IsHigh())
+}
+
+func TestRelayForce(t *testing.T) {
+	fa := newFakeAdaptor()
+	clk := &fakeClock{t: time.Now()}
+	rs := NewRelaySwitch("35", false, fa).WithLimits(DwellLimits{MinOn: 30 * time.Second, MinOff: 30 * time.Second})
+	rs.now = clk.now
+
+	assert.Nil(t, rs.High())
+	clk.advance(time.Second)
+	assert.Nil(t, rs.Force(false), "forcing bypasses the dwell limits")
+	assert.Equal(t, 0, fa.level("35"))
+	clk.advance(time.Second)
+	assert.Nil(t, rs.Force(true))
+	assert.Equal(t, 1, fa.level("35"))
+}
+
+func TestRelayFeedback(t *testing.T) {
+	fa := newFakeAdaptor()
+	reports := make(chan error, 4)
+	rs := NewRelaySwitch("35", false, fa).WithFeedback("37", func(err error) { reports <- err })
+
+	fa.set("37", 1) // contacts follow the pin
+	assert.Nil(t, rs.High())
+	assert.Nil(t, <-reports)
+
+	// relay is not locked while the contacts settle
+	done := make(chan error)
+	go func() { done <- rs.Low() }() // feedback still reads closed
+	time.Sleep(RELAY_SETTLE / 5)
+	start := time.Now()
+	assert.False(t, rs.IsHigh())
+	assert.Less(t, time.Since(start), RELAY_SETTLE/2, "state should not wait on the feedback")
+	err := <-done
+	assert.True(t, errors.Is(err, ErrVerify), "Unexpected error %v", err)
+	assert.True(t, errors.Is(<-reports, ErrVerify))
+
+	fa.failWrites(errors.New("pin busy"))
+	err = rs.High()
+	assert.True(t, errors.Is(err, ErrWrite), "Unexpected error %v", err)
+	assert.False(t, errors.Is(err, ErrVerify), "failed write is not a feedback mismatch")
+	assert.True(t, errors.Is(<-reports, ErrWrite))
+	assert.False(t, rs.IsHigh(), "failed write should not change state")
+}
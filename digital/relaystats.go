@@ -0,0 +1,167 @@
+package digital
+
+/* ====================
+Pumps and relays have finite duty lives. Rather than guessing when to replace them, each RelaySwitch keeps a running account of how long it has been on and how many times it has switched.
+StatsFile persists such accounts across restarts as a small json file keyed by the relay name.
+==================== */
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RelayStats : cumulative usage of a relay
+type RelayStats struct {
+	OnTime   time.Duration `json:"ontime"`   // total time the relay has been closed
+	Switches int64         `json:"switches"` // total number of switches, on and off both count
+	LastOn   time.Time     `json:"laston"`   // time the relay was last closed
+	LastOff  time.Time     `json:"lastoff"`  // time the relay was last opened
+}
+
+// Hours : cumulative on-time in hours, handy for display & logs
+func (st RelayStats) Hours() float64 {
+	return st.OnTime.Hours()
+}
+
+// Stats : usage of the relay so far, including the current on spell if the relay is on
+func (rs *RelaySwitch) Stats() RelayStats {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	st := rs.stats
+	if rs.state && !st.LastOn.IsZero() {
+		st.OnTime += rs.now().Sub(st.LastOn)
+	}
+	return st
+}
+
+// Restore : seeds the usage from a previous run, call before Boot
+// A relay that was on when the previous run went down would be opened by Boot, which then counts as the last off time
+// On-time between the last save and going down is lost, save often enough for that not to matter
+func (rs *RelaySwitch) Restore(st RelayStats) *RelaySwitch {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.stats = st
+	return rs
+}
+
+// account : updates the usage for a switch that just happened
+// call this with the lock held
+func (rs *RelaySwitch) account(on bool, at time.Time) {
+	rs.stats.Switches++
+	if on {
+		rs.stats.LastOn = at
+		return
+	}
+	if !rs.stats.LastOn.IsZero() && rs.stats.LastOn.After(rs.stats.LastOff) {
+		rs.stats.OnTime += at.Sub(rs.stats.LastOn)
+	}
+	rs.stats.LastOff = at
+}
+
+// StatsFile : json file on disk that holds the usage of all the relays keyed by name
+type StatsFile struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewStatsFile : ctor for the stats file, the file need not exist yet
+//
+/*
+	sf := digital.NewStatsFile("/var/lib/aquapone/relaystats.json")
+	rs := digital.NewRelaySwitch("35", false, r)
+	rs.SetName("pump")
+	if err := sf.Load(rs); err != nil {
+		log.Warnf("relay stats not restored: %s", err)
+	}
+	rs.Boot()
+	sf.Sync(5*time.Minute, ctx, &wg, rs)
+*/
+func NewStatsFile(path string) *StatsFile {
+	return &StatsFile{path: path}
+}
+
+// Load : restores the usage of relays by their names. A missing file is not an error, relays then start afresh
+func (sf *StatsFile) Load(relays ...*RelaySwitch) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	byt, err := os.ReadFile(sf.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read relay stats file %s: %w", sf.path, err)
+	}
+	all := map[string]RelayStats{}
+	if err := json.Unmarshal(byt, &all); err != nil {
+		return fmt.Errorf("failed to unmarshal relay stats file %s: %w", sf.path, err)
+	}
+	for _, rs := range relays {
+		if st, ok := all[rs.Name()]; ok {
+			rs.Restore(st)
+		}
+	}
+	return nil
+}
+
+// Save : writes the usage of the relays to file
+// file is written alongside and then renamed so that a power cut midway does not corrupt the previous copy
+func (sf *StatsFile) Save(relays ...*RelaySwitch) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	all := map[string]RelayStats{}
+	for _, rs := range relays {
+		all[rs.Name()] = rs.Stats()
+	}
+	byt, err := json.MarshalIndent(all, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to marshal relay stats: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(sf.path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for relay stats: %w", err)
+	}
+	tmp := sf.path + ".tmp"
+	if err := os.WriteFile(tmp, byt, 0644); err != nil {
+		return fmt.Errorf("failed to write relay stats file %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, sf.path)
+}
+
+// Sync : saves the usage of the relays every interval and once more when the context is done
+// Each save is also logged, so that the journal carries a trail of the relay usage
+func (sf *StatsFile) Sync(interval time.Duration, ctx context.Context, wg *sync.WaitGroup, relays ...*RelaySwitch) {
+	save := func() {
+		if err := sf.Save(relays...); err != nil {
+			logrus.Error(err)
+			return
+		}
+		for _, rs := range relays {
+			st := rs.Stats()
+			logrus.WithFields(logrus.Fields{
+				"relay":    rs.Name(),
+				"hours":    fmt.Sprintf("%.2f", st.Hours()),
+				"switches": st.Switches,
+			}).Debug("relay usage")
+		}
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer logrus.Warn("Now closing relay stats sync..")
+		for {
+			select {
+			case <-time.After(interval):
+				save()
+			case <-ctx.Done():
+				save()
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,48 @@
+package digital
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelayStatsPersist(t *testing.T) {
+	fa := newFakeAdaptor()
+	clk := &fakeClock{t: time.Now()}
+	rs := NewRelaySwitch("35", false, fa)
+	rs.SetName("pump")
+	rs.now = clk.now
+
+	assert.Nil(t, rs.High())
+	clk.advance(10 * time.Minute)
+	assert.Nil(t, rs.Low())
+	clk.advance(5 * time.Minute)
+	assert.Nil(t, rs.High())
+	clk.advance(2 * time.Minute)
+
+	st := rs.Stats()
+	assert.Equal(t, int64(3), st.Switches)
+	assert.Equal(t, 12*time.Minute, st.OnTime, "on-time should include the current spell")
+
+	sf := NewStatsFile(filepath.Join(t.TempDir(), "state", "relaystats.json"))
+	assert.Nil(t, sf.Save(rs))
+
+	restored := NewRelaySwitch("35", false, fa)
+	restored.SetName("pump")
+	restored.now = clk.now
+	assert.Nil(t, sf.Load(restored))
+	restored.Boot()
+	st = restored.Stats()
+	assert.Equal(t, int64(4), st.Switches, "boot opening a relay that was on counts as a switch")
+	assert.Equal(t, 12*time.Minute, st.OnTime)
+	assert.Equal(t, clk.now(), st.LastOff)
+}
+
+func TestRelayStatsMissingFile(t *testing.T) {
+	rs := NewRelaySwitch("35", false, newFakeAdaptor())
+	sf := NewStatsFile(filepath.Join(t.TempDir(), "nosuchfile.json"))
+	assert.Nil(t, sf.Load(rs), "missing stats file should not be an error")
+	assert.Equal(t, RelayStats{}, rs.Stats())
+}
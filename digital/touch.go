@@ -13,11 +13,13 @@ import (
 const (
 	FAST_WATCH_5V   = 250 * time.Millisecond // when connected to 5V Vcc
 	SLOW_WATCH_3_3V = 600 * time.Millisecond // when connected to 3.3 Vcc
+	GESTURE_WATCH   = 20 * time.Millisecond  // telling taps from double taps needs much faster sampling
 )
 
 type TouchSensor struct {
 	*gpio.DirectPinDriver
-	state bool // represents the state of the pin
+	state bool     // represents the state of the pin
+	chip  GpioChip // edges from the gpio chip when not nil, else the pin is polled
 }
 
 func NewTouchSensor(pin string, adp gobot.Adaptor) *TouchSensor {
@@ -27,11 +29,39 @@ func NewTouchSensor(pin string, adp gobot.Adaptor) *TouchSensor {
 	}
 }
 
+// WithChip : touches are then read as edge events from the gpio chip, polling only if the line cannot be had
+// nil chip leaves the sensor polled
+func (ts *TouchSensor) WithChip(chip GpioChip) *TouchSensor {
+	ts.chip = chip
+	return ts
+}
+
 func (ts *TouchSensor) Boot() *TouchSensor {
-	ts.DirectPinDriver.DigitalWrite(0) // to start with the pin is off
+	if ts.chip == nil {
+		ts.DirectPinDriver.DigitalWrite(0) // to start with the pin is off
+	}
 	return ts
 }
 
+// lineEvents : edges on the sensor line from the gpio chip, nil when polling
+func (ts *TouchSensor) lineEvents(ctx context.Context, wg *sync.WaitGroup) (chan Edge, bool) {
+	if ts.chip == nil {
+		return nil, false
+	}
+	line, err := ts.chip.RequestEvents(ts.Pin(), "touch")
+	if err != nil {
+		logrus.Warnf("touch sensor falls back to polling: %s", err)
+		return nil, false
+	}
+	level, err := line.Value()
+	if err != nil {
+		line.Close()
+		logrus.Warnf("touch sensor falls back to polling: %s", err)
+		return nil, false
+	}
+	return WatchEdges(line, ctx, wg), level
+}
+
 func (ts *TouchSensor) ShutD() {
 	ts.DirectPinDriver.DigitalWrite(0)
 }
@@ -40,6 +70,20 @@ func (ts *TouchSensor) Watch(speed time.Duration, ctx context.Context, wg *sync.
 	// making an unbufferred channel with overflow configuration
 	// When the listener isnt ready channel would overflow and hencee only one tick is sent
 	touches := make(chan time.Time, 1)
+	if edges, _ := ts.lineEvents(ctx, wg); edges != nil {
+		wg.Add(1)
+		go func() {
+			defer logrus.Warn("Now closing touch sensor..")
+			defer wg.Done()
+			defer close(touches)
+			for e := range edges {
+				if e.Rising && len(touches) < 1 {
+					touches <- e.At
+				}
+			}
+		}()
+		return touches
+	}
 	wg.Add(1)
 	go func() {
 		defer logrus.Warn("Now closing touch sensor..")
@@ -59,3 +103,55 @@ func (ts *TouchSensor) Watch(speed time.Duration, ctx context.Context, wg *sync.
 	}()
 	return touches
 }
+
+// Gestures : samples the sensor every speed and sends out debounced touch events & gestures
+// a brush against the sensor is thus not the same as a deliberate hold
+// with the gpio chip, the sensor is sampled only while a gesture is in progress and the edges come in from the kernel
+func (ts *TouchSensor) Gestures(speed time.Duration, cfg GestureConfig, ctx context.Context, wg *sync.WaitGroup) chan PressEvent {
+	gestures := make(chan PressEvent, 10)
+	detector := NewPressDetector(cfg)
+	if edges, level := ts.lineEvents(ctx, wg); edges != nil {
+		wg.Add(1)
+		go func() {
+			defer logrus.Warn("Now closing touch gestures..")
+			defer wg.Done()
+			defer close(gestures)
+			feedEdges(edges, level, false, detector, speed, ctx, func(evt PressEvent) bool {
+				ts.state = detector.IsPressed()
+				select {
+				case gestures <- evt:
+					return true
+				case <-ctx.Done():
+					return false
+				}
+			})
+		}()
+		return gestures
+	}
+	wg.Add(1)
+	go func() {
+		defer logrus.Warn("Now closing touch gestures..")
+		defer wg.Done()
+		defer close(gestures)
+		for {
+			select {
+			case <-time.After(speed):
+				val, err := ts.DirectPinDriver.DigitalRead()
+				if err != nil {
+					continue
+				}
+				for _, evt := range detector.Feed(val == 1, time.Now()) {
+					ts.state = detector.IsPressed()
+					select {
+					case gestures <- evt:
+					case <-ctx.Done():
+						return
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return gestures
+}
@@ -0,0 +1,95 @@
+package interrupt
+
+/* ====================
+Touch sensor, buttons, system signals, remote commands over the broker and trigger files dropped on disk - all of them interrupt the schedule to ask for something.
+Source is the one shape they all take, and Merge fans in any number of them into one channel of events tagged with where they came from.
+Application then has a single loop that dispatches the events, instead of a hand written select for every combination of sources.
+==================== */
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Origins of the events
+const (
+	ORIGIN_TOUCH  = "touch"
+	ORIGIN_BUTTON = "button"
+	ORIGIN_SIGNAL = "signal"
+	ORIGIN_AMQP   = "amqp"
+	ORIGIN_FILE   = "file"
+)
+
+var (
+	// REMOTE_COMMANDS : all that the broker & trigger files can ask for
+	// anyone who can publish on the queue or write to the directory should not be able to take the application down
+	REMOTE_COMMANDS = map[string]bool{"override": true, "reload": true, "status": true}
+)
+
+// Event : one interruption from a source
+type Event struct {
+	Origin string    // source the event came from
+	At     time.Time // time of the event at the source
+	Kind   string    // what is asked for : gesture, signal command or the remote command
+	Args   []string  // arguments of the remote command if any
+}
+
+// Permitted : false for the commands from the broker or trigger files that are not in REMOTE_COMMANDS
+func (evt Event) Permitted() bool {
+	if evt.Origin != ORIGIN_AMQP && evt.Origin != ORIGIN_FILE {
+		return true
+	}
+	return REMOTE_COMMANDS[evt.Kind]
+}
+
+// Source : anything that sends out interruptions till the context is done
+type Source interface {
+	Name() string
+	Events(ctx context.Context, wg *sync.WaitGroup) chan Event
+}
+
+// ParseCommand : event from a command line like "override on 10m", first word is the kind and the rest are args
+func ParseCommand(origin, line string, at time.Time) (Event, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return Event{}, false
+	}
+	return Event{Origin: origin, At: at, Kind: strings.ToLower(fields[0]), Args: fields[1:]}, true
+}
+
+// Merge : fans in the events from all the sources, channel is closed once all the sources are done
+//
+/*
+	for evt := range interrupt.Merge(ctx, &wg, interrupt.NewSignalSource(), interrupt.NewTouchSource("31", digital.DEFAULT_GESTURES, nil, r)) {
+		log.Debugf("%s from %s", evt.Kind, evt.Origin)
+	}
+*/
+func Merge(ctx context.Context, wg *sync.WaitGroup, sources ...Source) chan Event {
+	merged := make(chan Event, len(sources)+1)
+	var running sync.WaitGroup
+	for _, src := range sources {
+		events := src.Events(ctx, wg)
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			for evt := range events {
+				select {
+				case merged <- evt:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(merged)
+		defer logrus.Warn("Now closing merged interrupts..")
+		running.Wait()
+	}()
+	return merged
+}
@@ -0,0 +1,137 @@
+package interrupt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSource : sends out the events it is given and then waits for the context
+type fakeSource struct {
+	name   string
+	events []Event
+}
+
+func (fs *fakeSource) Name() string {
+	return fs.name
+}
+
+func (fs *fakeSource) Events(ctx context.Context, wg *sync.WaitGroup) chan Event {
+	events := make(chan Event, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(events)
+		for _, evt := range fs.events {
+			events <- evt
+		}
+		<-ctx.Done()
+	}()
+	return events
+}
+
+func TestParseCommand(t *testing.T) {
+	now := time.Now()
+	evt, ok := ParseCommand(ORIGIN_AMQP, "  Override 10m \n", now)
+	assert.True(t, ok)
+	assert.Equal(t, Event{Origin: ORIGIN_AMQP, At: now, Kind: "override", Args: []string{"10m"}}, evt)
+	evt, ok = ParseCommand(ORIGIN_AMQP, "status", now)
+	assert.True(t, ok)
+	assert.Equal(t, "status", evt.Kind)
+	assert.Empty(t, evt.Args)
+	_, ok = ParseCommand(ORIGIN_AMQP, " \n ", now)
+	assert.False(t, ok, "blank line is no command")
+}
+
+func TestPermitted(t *testing.T) {
+	for _, origin := range []string{ORIGIN_AMQP, ORIGIN_FILE} {
+		assert.True(t, Event{Origin: origin, Kind: "override", Args: []string{"on", "10m"}}.Permitted())
+		assert.True(t, Event{Origin: origin, Kind: "status"}.Permitted())
+		assert.False(t, Event{Origin: origin, Kind: "shutdown"}.Permitted(), "remotes cannot take the application down")
+		assert.False(t, Event{Origin: origin, Kind: "nextpage"}.Permitted())
+	}
+	assert.True(t, Event{Origin: ORIGIN_SIGNAL, Kind: "shutdown"}.Permitted())
+	assert.True(t, Event{Origin: ORIGIN_TOUCH, Kind: "long"}.Permitted(), "gestures are mapped to actions later")
+}
+
+func TestMerge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	merged := Merge(ctx, &wg,
+		&fakeSource{name: ORIGIN_TOUCH, events: []Event{{Origin: ORIGIN_TOUCH, Kind: "short"}, {Origin: ORIGIN_TOUCH, Kind: "double"}}},
+		&fakeSource{name: ORIGIN_SIGNAL, events: []Event{{Origin: ORIGIN_SIGNAL, Kind: "reload"}}},
+		&fakeSource{name: ORIGIN_FILE},
+	)
+	got := map[string][]string{}
+	for i := 0; i < 3; i++ {
+		select {
+		case evt := <-merged:
+			got[evt.Origin] = append(got[evt.Origin], evt.Kind)
+		case <-time.After(time.Second):
+			t.Fatal("events not merged")
+		}
+	}
+	assert.Equal(t, []string{"short", "double"}, got[ORIGIN_TOUCH], "order from a source is kept")
+	assert.Equal(t, []string{"reload"}, got[ORIGIN_SIGNAL])
+	cancel()
+	select {
+	case _, ok := <-merged:
+		assert.False(t, ok, "merged channel closes once the sources are done")
+	case <-time.After(time.Second):
+		t.Fatal("merged channel not closed")
+	}
+	wg.Wait()
+}
+
+func TestFileSource(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "triggers")
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	events := NewFileSource(dir, 50*time.Millisecond).Events(ctx, &wg)
+	assert.DirExists(t, dir, "trigger directory is created")
+
+	backdate := func(name string, d time.Duration) {
+		at := time.Now().Add(-d)
+		assert.Nil(t, os.Chtimes(filepath.Join(dir, name), at, at))
+	}
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "override"), []byte("10m\n"), 0660))
+	backdate("override", time.Minute)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "reload"), nil, 0660))
+	backdate("reload", 30*time.Second)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "status"), []byte("now"), 0660)) // still being written
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, ".status"), nil, 0660))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "nextpage.tmp"), nil, 0660))
+	backdate("nextpage.tmp", time.Minute)
+
+	next := func(kind string) Event {
+		select {
+		case evt := <-events:
+			evt.At = time.Time{}
+			return evt
+		case <-time.After(time.Second):
+			t.Fatalf("no event for trigger %s", kind)
+		}
+		return Event{}
+	}
+	assert.Equal(t, Event{Origin: ORIGIN_FILE, Kind: "override", Args: []string{"10m"}}, next("override"), "triggers come oldest first")
+	assert.Equal(t, Event{Origin: ORIGIN_FILE, Kind: "reload", Args: []string{}}, next("reload"))
+	select {
+	case evt := <-events:
+		t.Fatalf("trigger still being written was read: %v", evt)
+	case <-time.After(200 * time.Millisecond):
+	}
+	assert.FileExists(t, filepath.Join(dir, "status"))
+	backdate("status", 2*TRIGGER_SETTLE)
+	assert.Equal(t, Event{Origin: ORIGIN_FILE, Kind: "status", Args: []string{"now"}}, next("status"), "read once left alone")
+	assert.NoFileExists(t, filepath.Join(dir, "override"), "trigger is removed once read")
+	assert.NoFileExists(t, filepath.Join(dir, "reload"))
+	assert.FileExists(t, filepath.Join(dir, ".status"), "hidden files are left alone")
+	assert.FileExists(t, filepath.Join(dir, "nextpage.tmp"), "so are the ones written aside")
+	cancel()
+	wg.Wait()
+}
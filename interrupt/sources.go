@@ -0,0 +1,288 @@
+package interrupt
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eensymachines-in/patio/broker"
+	"github.com/eensymachines-in/patio/digital"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sirupsen/logrus"
+	"gobot.io/x/gobot"
+)
+
+const (
+	TRIGGER_POLL   = 1 * time.Second // trigger directory is scanned this often
+	TRIGGER_SETTLE = 1 * time.Second // trigger file modified within this is taken to be still written to
+)
+
+// touchSource : gestures on the touch sensor
+type touchSource struct {
+	pin  string
+	cfg  digital.GestureConfig
+	chip digital.GpioChip
+	adp  gobot.Adaptor
+}
+
+// NewTouchSource : gestures on the touch sensor, event kind is the gesture - short, long or double
+// chip is for the edge events, nil to poll the pin
+func NewTouchSource(pin string, cfg digital.GestureConfig, chip digital.GpioChip, adp gobot.Adaptor) Source {
+	return &touchSource{pin: pin, cfg: cfg, chip: chip, adp: adp}
+}
+
+func (ts *touchSource) Name() string {
+	return ORIGIN_TOUCH
+}
+
+func (ts *touchSource) Events(ctx context.Context, wg *sync.WaitGroup) chan Event {
+	return gestureEvents(ORIGIN_TOUCH, TouchGestureWatch(ts.pin, ts.cfg, ts.chip, ts.adp, ctx, wg), ctx, wg)
+}
+
+// buttonSource : gestures on a tactile button
+type buttonSource struct {
+	btn *digital.InterruptButton
+}
+
+// NewButtonSource : gestures on the button, event kind is the gesture - short, long or double
+func NewButtonSource(pin string, pull uint8, cfg digital.GestureConfig, chip digital.GpioChip, adp gobot.Adaptor) Source {
+	return &buttonSource{btn: digital.NewInterruptButton(pin, pull, adp).WithGestures(cfg).WithChip(chip)}
+}
+
+func (bs *buttonSource) Name() string {
+	return ORIGIN_BUTTON
+}
+
+func (bs *buttonSource) Events(ctx context.Context, wg *sync.WaitGroup) chan Event {
+	presses := bs.btn.Start(digital.BTN_POLL, ctx, wg)
+	gestures := make(chan digital.PressEvent, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(gestures)
+		for p := range presses {
+			if p.Kind == digital.PRESS || p.Kind == digital.RELEASE {
+				continue // only the gestures
+			}
+			select {
+			case gestures <- p:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return gestureEvents(ORIGIN_BUTTON, gestures, ctx, wg)
+}
+
+// gestureEvents : press gestures to events
+func gestureEvents(origin string, gestures chan digital.PressEvent, ctx context.Context, wg *sync.WaitGroup) chan Event {
+	events := make(chan Event, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(events)
+		for g := range gestures {
+			select {
+			case events <- Event{Origin: origin, At: g.At, Kind: g.Kind.String()}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events
+}
+
+// signalSource : system signals
+type signalSource struct{}
+
+// NewSignalSource : system signals, event kind is the command - shutdown, reload or status
+func NewSignalSource() Source {
+	return &signalSource{}
+}
+
+func (ss *signalSource) Name() string {
+	return ORIGIN_SIGNAL
+}
+
+func (ss *signalSource) Events(ctx context.Context, wg *sync.WaitGroup) chan Event {
+	commands := SysCommandWatch(ctx, wg)
+	events := make(chan Event, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(events)
+		for cmd := range commands {
+			select {
+			case events <- Event{Origin: ORIGIN_SIGNAL, At: time.Now(), Kind: cmd.String()}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events
+}
+
+// amqpSource : remote commands from a queue on the broker
+type amqpSource struct {
+	link  *broker.Link
+	queue string
+}
+
+// NewAMQPSource : remote commands, each message on the queue is one command line like "override on 10m"
+// queue is declared if it does not exist, and consumed afresh every time the link comes back up
+func NewAMQPSource(link *broker.Link, queue string) Source {
+	return &amqpSource{link: link, queue: queue}
+}
+
+func (as *amqpSource) Name() string {
+	return ORIGIN_AMQP
+}
+
+// consume : opens a channel on the link and starts consuming the queue
+func (as *amqpSource) consume() (*amqp.Channel, <-chan amqp.Delivery, error) {
+	ch, err := as.link.Channel()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := ch.QueueDeclare(as.queue, true, false, false, false, nil); err != nil {
+		ch.Close()
+		return nil, nil, fmt.Errorf("failed to declare command queue %s: %w", as.queue, err)
+	}
+	deliveries, err := ch.Consume(as.queue, "", true, false, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, nil, fmt.Errorf("failed to consume command queue %s: %w", as.queue, err)
+	}
+	return ch, deliveries, nil
+}
+
+func (as *amqpSource) Events(ctx context.Context, wg *sync.WaitGroup) chan Event {
+	events := make(chan Event, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(events)
+		defer logrus.Warn("Now closing remote commands..")
+		for {
+			ch, deliveries, err := as.consume()
+			if err != nil {
+				logrus.Debugf("remote commands not available: %s", err)
+				select {
+				case <-time.After(broker.REDIAL_INTERVAL):
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+			logrus.WithFields(logrus.Fields{"queue": as.queue}).Info("listening for remote commands")
+		consume:
+			for {
+				select {
+				case d, ok := <-deliveries:
+					if !ok {
+						break consume // channel or link went down, consume afresh
+					}
+					at := d.Timestamp
+					if at.IsZero() {
+						at = time.Now()
+					}
+					if evt, ok := ParseCommand(ORIGIN_AMQP, string(d.Body), at); ok {
+						select {
+						case events <- evt:
+						case <-ctx.Done():
+							ch.Close()
+							return
+						}
+					}
+				case <-ctx.Done():
+					ch.Close()
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// fileSource : trigger files dropped in a directory
+type fileSource struct {
+	dir  string
+	poll time.Duration
+}
+
+// NewFileSource : every file dropped in the directory is a command, file name is the kind and the contents are the args
+// file is removed once read, so that the same trigger is not picked twice
+// file is read only once it is left alone for TRIGGER_SETTLE, hidden & .tmp files are for writing the trigger aside and renaming it in
+//
+/*
+	echo 10m > /run/aquapone/triggers/override
+*/
+func NewFileSource(dir string, poll time.Duration) Source {
+	return &fileSource{dir: dir, poll: poll}
+}
+
+func (fs *fileSource) Name() string {
+	return ORIGIN_FILE
+}
+
+// scan : trigger files in the directory as events, oldest first
+func (fs *fileSource) scan() []Event {
+	entries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return nil
+	}
+	events := []Event{}
+	for _, e := range entries {
+		if e.IsDir() || e.Name()[0] == '.' || strings.HasSuffix(e.Name(), ".tmp") {
+			continue // hidden files are triggers still being written
+		}
+		path := filepath.Join(fs.dir, e.Name())
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) < TRIGGER_SETTLE {
+			continue // picked up with a later scan once done writing
+		}
+		byt, err := os.ReadFile(path)
+		os.Remove(path)
+		if err != nil {
+			continue
+		}
+		if evt, ok := ParseCommand(ORIGIN_FILE, e.Name()+" "+string(byt), info.ModTime()); ok {
+			events = append(events, evt)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At.Before(events[j].At) })
+	return events
+}
+
+func (fs *fileSource) Events(ctx context.Context, wg *sync.WaitGroup) chan Event {
+	events := make(chan Event, 1)
+	if err := os.MkdirAll(fs.dir, 0770); err != nil {
+		logrus.Errorf("trigger directory not available: %s", err)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(events)
+		defer logrus.Warn("Now closing trigger files..")
+		for {
+			select {
+			case <-time.After(fs.poll):
+				for _, evt := range fs.scan() {
+					select {
+					case events <- evt:
+					case <-ctx.Done():
+						return
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events
+}
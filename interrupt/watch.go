@@ -38,6 +38,7 @@ func SysSignalWatch(ctx context.Context, wg *sync.WaitGroup) chan time.Time {
 	go func() {
 		defer wg.Done()
 		defer close(signals)
+		defer signal.Stop(signals) // has to stop before the channel is closed
 		defer close(interrupt)
 		defer logrus.Warn("Now closing loop for SysSignalWatch")
 
@@ -56,6 +57,78 @@ func SysSignalWatch(ctx context.Context, wg *sync.WaitGroup) chan time.Time {
 	return interrupt
 }
 
+// SysCommand : what the operator asks of the application through system signals
+type SysCommand uint8
+
+const (
+	CMD_SHUTDOWN SysCommand = iota // SIGINT, SIGTERM, SIGABRT
+	CMD_RELOAD                     // SIGHUP, systemctl reload
+	CMD_STATUS                     // SIGUSR1, status dump in the log
+)
+
+func (sc SysCommand) String() string {
+	switch sc {
+	case CMD_SHUTDOWN:
+		return "shutdown"
+	case CMD_RELOAD:
+		return "reload"
+	case CMD_STATUS:
+		return "status"
+	}
+	return "unknown"
+}
+
+// SysCommandWatch : same as SysSignalWatch, but routes the signals to what the operator wants done
+// SIGHUP is a config reload and SIGUSR1 a status dump, only the rest are for shutting down
+//
+/*
+	for cmd := range SysCommandWatch(ctx, &wg) {
+		switch cmd {
+		case interrupt.CMD_SHUTDOWN:
+			cancel()
+		case interrupt.CMD_RELOAD:
+			reload()
+		}
+	}
+*/
+func SysCommandWatch(ctx context.Context, wg *sync.WaitGroup) chan SysCommand {
+	commands := make(chan SysCommand, 3)
+	signals := make(chan os.Signal, 3)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGABRT, syscall.SIGHUP, syscall.SIGUSR1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(signals)
+		defer signal.Stop(signals) // has to stop before the channel is closed
+		defer close(commands)
+		defer logrus.Warn("Now closing loop for SysCommandWatch")
+		for {
+			select {
+			case sig := <-signals:
+				cmd := CMD_SHUTDOWN
+				switch sig {
+				case syscall.SIGHUP:
+					cmd = CMD_RELOAD
+				case syscall.SIGUSR1:
+					cmd = CMD_STATUS
+				}
+				logrus.WithFields(logrus.Fields{
+					"signal":  sig,
+					"command": cmd,
+				}).Warn("system signal..")
+				select {
+				case commands <- cmd:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return commands
+}
+
 // TouchSensorWatch : watches grove touch sensor signal and interprets the same as interrupt signal
 // pin 				: pin on the SoC where the touch sensor is connected
 // adp				: connection adaptor for the SoC
@@ -81,11 +154,15 @@ func TouchSensorWatch(pin string, speed time.Duration, adp gobot.Adaptor, ctx co
 		defer wg.Done()
 		defer close(interrupt)
 		defer logrus.Warn("Now closing loop for TouchSensorWatch")
+		touches := touch.Watch(speed, ctx, wg) // one watch for the life of the loop
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case t := <-touch.Watch(speed, ctx, wg):
+			case t, ok := <-touches:
+				if !ok {
+					return
+				}
 				logrus.WithFields(logrus.Fields{
 					"time": t.Format(time.RFC822),
 				}).Warn("touch interrupt..")
@@ -96,47 +173,38 @@ func TouchSensorWatch(pin string, speed time.Duration, adp gobot.Adaptor, ctx co
 	return interrupt
 }
 
-// TouchOrSysSignal : Or combination for system interrupts & touch sensor button whichever occurs first
-// pin		: physical pin at which the button is connected to
-// adp		: connection to the device
+// TouchGestureWatch : watches the touch sensor for gestures (tap, hold, double tap) rather than any touch
+// Only the gestures are sent over, press & release edges are dropped
+// cfg				: debounce and gesture timings
+// chip				: gpio chip for the edge events, nil to poll the pin
 //
 /*
-	ctx, cancel := context.WithCancel(context.Background())
-	var wg sync.WaitGroup
-	r := raspi.NewAdaptor()
-	err := r.Connect()
-	if err != nil {
-		log.Panicf("failed to connect to raspberry device %s", err)
-	}
-	for t := range TouchOrSysSignal("PHY_PIN_NUM",r,ctx, &wg){
-		log.Debug("received interruption")
-		cancel()
+	chip, _ := digital.OpenGpioChip(digital.DEFAULT_GPIOCHIP)
+	for g := range TouchGestureWatch("PHY_PIN_NUM", digital.DEFAULT_GESTURES, chip, r, ctx, &wg) {
+		if g.Kind == digital.LONG_PRESS {
+			cancel()
+		}
 	}
-
 */
-func TouchOrSysSignal(pin string, speed time.Duration, adp gobot.Adaptor, ctx context.Context, wg *sync.WaitGroup) chan time.Time {
-	interrupt := make(chan time.Time, 1)
-	touch := digital.NewTouchSensor(pin, adp).Boot()
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGABRT)
+func TouchGestureWatch(pin string, cfg digital.GestureConfig, chip digital.GpioChip, adp gobot.Adaptor, ctx context.Context, wg *sync.WaitGroup) chan digital.PressEvent {
+	interrupt := make(chan digital.PressEvent, 1)
+	touch := digital.NewTouchSensor(pin, adp).WithChip(chip).Boot()
+	gestures := touch.Gestures(digital.GESTURE_WATCH, cfg, ctx, wg)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		defer close(signals)
 		defer close(interrupt)
-		defer logrus.Warn("Now closing loop for TouchOrSysSignal")
-		for {
+		defer logrus.Warn("Now closing loop for TouchGestureWatch")
+		for g := range gestures {
+			if g.Kind == digital.PRESS || g.Kind == digital.RELEASE {
+				continue
+			}
+			logrus.WithFields(logrus.Fields{
+				"time":    g.At.Format(time.RFC822),
+				"gesture": g.Kind,
+			}).Debug("touch gesture..")
 			select {
-			case <-touch.Watch(speed, ctx, wg):
-				logrus.WithFields(logrus.Fields{
-					"time": time.Now().Format(time.RFC822),
-				}).Warn("button interrupt..")
-				interrupt <- time.Now()
-			case <-signals:
-				logrus.WithFields(logrus.Fields{
-					"time": time.Now().Format(time.RFC822),
-				}).Warn("system interrupt..")
-				interrupt <- time.Now()
+			case interrupt <- g:
 			case <-ctx.Done():
 				return
 			}
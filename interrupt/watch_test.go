@@ -0,0 +1,32 @@
+package interrupt
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSysCommandWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	commands := SysCommandWatch(ctx, &wg)
+	for sig, want := range map[syscall.Signal]SysCommand{
+		syscall.SIGHUP:  CMD_RELOAD,
+		syscall.SIGUSR1: CMD_STATUS,
+		syscall.SIGTERM: CMD_SHUTDOWN,
+	} {
+		assert.Nil(t, syscall.Kill(syscall.Getpid(), sig))
+		select {
+		case cmd := <-commands:
+			assert.Equal(t, want, cmd, sig.String())
+		case <-time.After(time.Second):
+			t.Fatalf("no command for %s", sig)
+		}
+	}
+	cancel()
+	wg.Wait()
+}
@@ -0,0 +1,134 @@
+package level
+
+/* ====================
+A pump running dry burns out in minutes, and the schedule has no idea about water.
+DryRunGuard latches a block on the pump relay as soon as the low water float goes dry or the tank volume falls below a threshold.
+Block is released only when the water recovers with hysteresis - volume back above a higher release threshold, and the float wet for a while - so that ripples around the threshold cannot chatter the pump.
+Guard vets every switch of the relay it is attached to, no matter if the schedule or a manual command asks for it.
+==================== */
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	FLOAT_RECOVERY = 1 * time.Minute // float has to be wet this long before the block can release
+)
+
+var (
+	ErrDryRun = errors.New("pump blocked, fish tank low on water")
+)
+
+// DryRunGuard : latching block on the pump while the tank is low on water
+type DryRunGuard struct {
+	mu        sync.Mutex
+	dryLitres float64   // volume below which the pump is blocked, 0 when the volume is not sensed
+	relLitres float64   // volume above which the block can release
+	litres    float64   // last known volume, NaN when not known
+	floatWet  bool      // last known state of the low float
+	hasFloat  bool      // false when there is no float switch
+	wetSince  time.Time // time since the float is wet
+	blocked   bool
+	reason    string
+	since     time.Time // time since blocked
+	now       func() time.Time
+}
+
+// NewDryRunGuard : ctor for the guard
+// dryLitres	: block below this volume, 0 if only the float switch is used
+// relLitres	: release above this volume, has to be above dryLitres
+//
+/*
+	guard := level.NewDryRunGuard(250, 300)
+	rs.Guard(guard)
+	if guard.Float(wet) {
+		// block state changed
+	}
+*/
+func NewDryRunGuard(dryLitres, relLitres float64) *DryRunGuard {
+	if relLitres < dryLitres {
+		relLitres = dryLitres
+	}
+	return &DryRunGuard{
+		dryLitres: dryLitres,
+		relLitres: relLitres,
+		litres:    math.NaN(),
+		floatWet:  true,
+		now:       time.Now,
+	}
+}
+
+// Blocked : true when the pump is blocked, along with the reason and since when
+func (g *DryRunGuard) Blocked() (bool, string, time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.blocked, g.reason, g.since
+}
+
+// Float : updates the state of the low float, true when the block state changed
+func (g *DryRunGuard) Float(wet bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if wet && (!g.floatWet || !g.hasFloat) {
+		g.wetSince = g.now()
+	}
+	g.floatWet, g.hasFloat = wet, true
+	return g.evaluate()
+}
+
+// Litres : updates the volume in the tank, true when the block state changed
+func (g *DryRunGuard) Litres(litres float64) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.litres = litres
+	return g.evaluate()
+}
+
+// Check : re-evaluates the block with the passage of time, true when the block state changed
+// float recovery is timed, call this periodically
+func (g *DryRunGuard) Check() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.evaluate()
+}
+
+// evaluate : call with the lock held
+func (g *DryRunGuard) evaluate() bool {
+	volSensed := g.dryLitres > 0 && !math.IsNaN(g.litres)
+	if !g.blocked {
+		switch {
+		case g.hasFloat && !g.floatWet:
+			g.reason = "low water float is dry"
+		case volSensed && g.litres < g.dryLitres:
+			g.reason = fmt.Sprintf("tank at %.0fL, below %.0fL", g.litres, g.dryLitres)
+		default:
+			return false
+		}
+		g.blocked, g.since = true, g.now()
+		return true
+	}
+	if g.hasFloat && (!g.floatWet || g.now().Sub(g.wetSince) < FLOAT_RECOVERY) {
+		return false
+	}
+	if volSensed && g.litres < g.relLitres {
+		return false
+	}
+	g.blocked, g.reason = false, ""
+	return true
+}
+
+// Allow : implements digital.Guard, pump cannot be switched on while blocked
+func (g *DryRunGuard) Allow(name string, on bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if on && g.blocked {
+		return fmt.Errorf("%w: %s", ErrDryRun, g.reason)
+	}
+	return nil
+}
+
+// Settle : implements digital.Guard
+func (g *DryRunGuard) Settle(name string, on bool) {}
@@ -0,0 +1,29 @@
+package level
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunLatch(t *testing.T) {
+	at := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+	g := NewDryRunGuard(250, 300)
+	g.now = func() time.Time { return at }
+
+	assert.False(t, g.Litres(320), "no change above the threshold")
+	assert.Nil(t, g.Allow("pump", true))
+	assert.True(t, g.Litres(240), "block below the threshold")
+	assert.ErrorIs(t, g.Allow("pump", true), ErrDryRun)
+	assert.Nil(t, g.Allow("pump", false), "switching off is always allowed")
+	assert.False(t, g.Litres(280), "hysteresis, still below release")
+	assert.True(t, g.Litres(310), "released above the release threshold")
+
+	// float dry blocks irrespective of volume
+	assert.True(t, g.Float(false))
+	assert.False(t, g.Float(true), "float has to be wet for a while")
+	at = at.Add(FLOAT_RECOVERY)
+	assert.True(t, g.Check(), "released after float recovery")
+	assert.Nil(t, g.Allow("pump", true))
+}
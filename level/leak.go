@@ -0,0 +1,157 @@
+package level
+
+/* ====================
+Fish tank loses water steadily to evaporation, and in swings to the flood cycle - growbed holds up some water till the siphon drains it back.
+Anything beyond that is a leak, and a tank rupture has to be an alarm rather than a post-mortem.
+- Sudden loss : volume falls below the recent peak by more than the flood cycle can account for
+- Sustained loss : peak volume falls over hours by more than the evaporation can account for
+Peaks are compared rather than the samples, since the peak is when the growbed has drained back.
+Alarm once raised is latched - the loss ages out of the windows long before anyone has fixed the leak - till the volume is back up to what it was before the loss, or an operator acknowledges it.
+==================== */
+import (
+	"fmt"
+	"time"
+)
+
+type AlarmKind uint8
+
+const (
+	SUDDEN_LOSS AlarmKind = iota
+	SUSTAINED_LOSS
+)
+
+func (ak AlarmKind) String() string {
+	if ak == SUDDEN_LOSS {
+		return "sudden loss"
+	}
+	return "sustained loss"
+}
+
+// Alarm : water lost beyond what is expected
+type Alarm struct {
+	Kind   AlarmKind
+	At     time.Time
+	Lost   float64       // litres lost
+	Over   time.Duration // time over which it was lost
+	Litres float64       // volume in the tank now
+	Before float64       // volume before the loss, alarm clears once the tank is back up to it
+}
+
+func (al Alarm) Error() string {
+	return fmt.Sprintf("tank leak, %s of %.1fL over %s, %.1fL left", al.Kind, al.Lost, al.Over.Round(time.Minute), al.Litres)
+}
+
+// LeakConfig : expected losses & thresholds
+type LeakConfig struct {
+	Evaporation   float64       // litres per day
+	CycleLitres   float64       // litres the flood cycle holds up at most
+	SuddenLitres  float64       // loss beyond the cycle within the sudden window is a leak
+	SuddenWindow  time.Duration //
+	SustainWindow time.Duration // loss beyond evaporation over this window is a leak
+	Tolerance     float64       // litres of slack for the sustained loss
+}
+
+// Sample : volume in the tank at a time
+type Sample struct {
+	At     time.Time
+	Litres float64
+}
+
+// LeakDetector : keeps the volume history and checks every new sample for leaks
+// Not safe for concurrent use, feed it from a single loop
+type LeakDetector struct {
+	cfg     LeakConfig
+	samples []Sample
+	latched *Alarm // alarm raised and not yet cleared
+}
+
+// NewLeakDetector : ctor for the detector
+//
+/*
+	ld := level.NewLeakDetector(level.LeakConfig{
+		Evaporation:   4,
+		CycleLitres:   40,
+		SuddenLitres:  10,
+		SuddenWindow:  15 * time.Minute,
+		SustainWindow: 6 * time.Hour,
+		Tolerance:     5,
+	})
+	if alarm := ld.Add(time.Now(), litres); alarm != nil {
+		log.Error(alarm)
+	}
+*/
+func NewLeakDetector(cfg LeakConfig) *LeakDetector {
+	return &LeakDetector{cfg: cfg}
+}
+
+// peak : highest volume among the samples between the times
+func (ld *LeakDetector) peak(from, to time.Time) (float64, bool) {
+	peak, found := 0.0, false
+	for _, s := range ld.samples {
+		if s.At.Before(from) || s.At.After(to) {
+			continue
+		}
+		if !found || s.Litres > peak {
+			peak, found = s.Litres, true
+		}
+	}
+	return peak, found
+}
+
+// Acknowledge : clears the latched alarm, the volume now is taken as the new normal
+// false if there was no alarm to acknowledge
+func (ld *LeakDetector) Acknowledge() bool {
+	if ld.latched == nil {
+		return false
+	}
+	ld.latched, ld.samples = nil, nil
+	return true
+}
+
+// Add : new sample of the volume, alarm if the sample shows a leak or the alarm is latched - nil otherwise
+// samples are expected in the order of time
+func (ld *LeakDetector) Add(at time.Time, litres float64) *Alarm {
+	alarm := ld.check(at, litres)
+	if alarm != nil && ld.latched == nil {
+		ld.latched = alarm
+	}
+	if ld.latched == nil {
+		return nil
+	}
+	if alarm == nil {
+		if recent, _ := ld.peak(at.Add(-ld.cfg.SuddenWindow), at); recent+ld.cfg.Tolerance >= ld.latched.Before {
+			ld.latched = nil // topped up, or the leak was fixed
+			return nil
+		}
+	}
+	latched := *ld.latched
+	latched.Litres = litres
+	return &latched
+}
+
+// check : alarm if the new sample shows a leak
+func (ld *LeakDetector) check(at time.Time, litres float64) *Alarm {
+	ld.samples = append(ld.samples, Sample{At: at, Litres: litres})
+	// history beyond the sustained window (and a sudden window to find the old peak in) is of no use
+	cutoff := at.Add(-(ld.cfg.SustainWindow + ld.cfg.SuddenWindow))
+	i := 0
+	for i < len(ld.samples) && ld.samples[i].At.Before(cutoff) {
+		i++
+	}
+	ld.samples = ld.samples[i:]
+
+	recent, _ := ld.peak(at.Add(-ld.cfg.SuddenWindow), at)
+	if lost := recent - litres; lost > ld.cfg.CycleLitres+ld.cfg.SuddenLitres {
+		return &Alarm{Kind: SUDDEN_LOSS, At: at, Lost: lost, Over: ld.cfg.SuddenWindow, Litres: litres, Before: recent}
+	}
+	oldest := ld.samples[0].At
+	if ld.cfg.SustainWindow > 0 && at.Sub(oldest) >= ld.cfg.SustainWindow {
+		old, _ := ld.peak(oldest, oldest.Add(ld.cfg.SuddenWindow))
+		over := at.Sub(oldest)
+		expected := ld.cfg.Evaporation*over.Hours()/24 + ld.cfg.Tolerance
+		if lost := old - recent; lost > expected {
+			return &Alarm{Kind: SUSTAINED_LOSS, At: at, Lost: lost, Over: over, Litres: litres, Before: old}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package level
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testLeakConfig() LeakConfig {
+	return LeakConfig{
+		Evaporation:   4,
+		CycleLitres:   40,
+		SuddenLitres:  10,
+		SuddenWindow:  15 * time.Minute,
+		SustainWindow: 6 * time.Hour,
+		Tolerance:     5,
+	}
+}
+
+func TestLeakFloodCycle(t *testing.T) {
+	ld := NewLeakDetector(testLeakConfig())
+	start := time.Now()
+	// 12 hours of flood cycles every half hour, with evaporation
+	for m := 0; m < 12*60; m++ {
+		at := start.Add(time.Duration(m) * time.Minute)
+		litres := 400 - 4*float64(m)/(24*60)
+		if m%30 < 10 {
+			litres -= 40 // growbed holds up the water while flooding
+		}
+		assert.Nil(t, ld.Add(at, litres), "flood cycle & evaporation are not leaks, minute %d", m)
+	}
+}
+
+func TestLeakSudden(t *testing.T) {
+	ld := NewLeakDetector(testLeakConfig())
+	start := time.Now()
+	for m := 0; m < 30; m++ {
+		assert.Nil(t, ld.Add(start.Add(time.Duration(m)*time.Minute), 400))
+	}
+	alarm := ld.Add(start.Add(30*time.Minute), 340)
+	if assert.NotNil(t, alarm) {
+		assert.Equal(t, SUDDEN_LOSS, alarm.Kind)
+		assert.InDelta(t, 60, alarm.Lost, 0.01)
+	}
+}
+
+func TestLeakSustained(t *testing.T) {
+	ld := NewLeakDetector(testLeakConfig())
+	start := time.Now()
+	var alarm *Alarm
+	// slow drip of 3L an hour, far beyond evaporation yet never sudden
+	for m := 0; m < 7*60 && alarm == nil; m++ {
+		alarm = ld.Add(start.Add(time.Duration(m)*time.Minute), 400-3*float64(m)/60)
+	}
+	if assert.NotNil(t, alarm) {
+		assert.Equal(t, SUSTAINED_LOSS, alarm.Kind)
+	}
+}
+
+func TestLeakLatched(t *testing.T) {
+	ld := NewLeakDetector(testLeakConfig())
+	start := time.Now()
+	m := 0
+	feed := func(mins int, litres float64) (alarms int) {
+		for end := m + mins; m < end; m++ {
+			if ld.Add(start.Add(time.Duration(m)*time.Minute), litres) != nil {
+				alarms++
+			}
+		}
+		return alarms
+	}
+	assert.Equal(t, 0, feed(30, 400))
+	assert.Equal(t, 60, feed(60, 340), "alarm stays raised long after the drop leaves the sudden window")
+	alarm := ld.Add(start.Add(time.Duration(m)*time.Minute), 340)
+	if assert.NotNil(t, alarm) {
+		assert.Equal(t, SUDDEN_LOSS, alarm.Kind)
+		assert.InDelta(t, 400, alarm.Before, 0.01)
+		assert.InDelta(t, 340, alarm.Litres, 0.01)
+	}
+	m++
+	assert.Equal(t, 0, feed(30, 398), "topped up, alarm clears")
+
+	assert.Equal(t, 30, feed(30, 330))
+	assert.True(t, ld.Acknowledge())
+	assert.False(t, ld.Acknowledge(), "nothing left to acknowledge")
+	assert.Equal(t, 0, feed(60, 330), "acknowledged, volume now is the new normal")
+}
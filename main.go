@@ -10,23 +10,44 @@ place		: Pune
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/eensymachines-in/patio/analog"
+	"github.com/eensymachines-in/patio/api"
 	"github.com/eensymachines-in/patio/aquacfg"
+	"github.com/eensymachines-in/patio/broker"
+	"github.com/eensymachines-in/patio/control"
 	"github.com/eensymachines-in/patio/digital"
 	"github.com/eensymachines-in/patio/interrupt"
+	"github.com/eensymachines-in/patio/level"
+	"github.com/eensymachines-in/patio/onewire"
+	"github.com/eensymachines-in/patio/sensors"
+	"github.com/eensymachines-in/patio/shutdown"
 	"github.com/eensymachines-in/patio/tickers"
+	"github.com/eensymachines-in/patio/watchdog"
 	oled "github.com/eensymachines-in/ssd1306"
 	log "github.com/sirupsen/logrus"
 	_ "gobot.io/x/gobot"
 	"gobot.io/x/gobot/platforms/raspi"
 )
 
+const (
+	DEFAULT_RELAY_STATEFILE = "/var/lib/aquapone/relaystats.json"
+	RELAY_STATS_SYNC        = 5 * time.Minute // interval at which relay usage is saved to file
+	LEVEL_SAMPLING          = 1 * time.Minute // interval at which the tank level is sampled
+	RELAY_SHUTDOWN          = 5 * time.Second // relays have this long to get to their safe state on shutdown
+	NEXT_TRANSITIONS        = 4               // upcoming schedule switches the api lists
+)
+
 var (
 	config = aquacfg.AppConfig{}
 )
@@ -43,6 +64,20 @@ func init() {
 		GPIO_TOUCH
 		GPIO_ERRLED
 		GPIO_PUMP_MAIN
+		optional
+		GPIO_PUMP_FEEDBACK
+		GPIO_PUMP_PWM
+		GPIO_FLOW_DRAIN
+		GPIO_FLOAT_LOW
+		GPIO_LEVEL_TRIG
+		GPIO_LEVEL_ECHO
+		GPIO_CHIP
+		GPIO_BUTTON
+		AMQP_CMDQUEUE
+		PATH_TRIGGERS
+		HTTP_ADDR
+		HTTP_TOKEN
+		PATH_CTLSOCK
 	*/
 	for _, v := range []string{
 		"PATH_APPCONFIG",
@@ -72,20 +107,9 @@ func init() {
 		log.SetLevel(log.Level(lvl)) // sets from the environment
 	}
 
-	// TODO: read configuration file and hoist all the vars
-	f, err := os.Open(os.Getenv("PATH_APPCONFIG"))
-	if err != nil || f == nil {
-		log.Panicf("failed to access application configuration file %s", err)
-		return
-	}
-	byt, err := io.ReadAll(f)
+	config, err = readConfig(os.Getenv("PATH_APPCONFIG"))
 	if err != nil {
-		log.Panicf("failed to read config.json %s", err)
-		return
-	}
-
-	if err := json.Unmarshal(byt, &config); err != nil {
-		log.Panicf("failed to unmarshal config.json %s", err)
+		log.Panic(err)
 		return
 	}
 	log.WithFields(log.Fields{
@@ -93,6 +117,9 @@ func init() {
 		"sched":    config.Schedule.Config,
 		"tick":     config.Schedule.TickAt,
 		"pulsegap": config.Schedule.PulseGap,
+		"minon":    config.Relay.MinOn,
+		"minoff":   config.Relay.MinOff,
+		"maxphr":   config.Relay.MaxPerHour,
 	}).Debug("read in app config")
 }
 
@@ -111,28 +138,400 @@ func main() {
 	r := raspi.NewAdaptor()
 	r.Connect()
 
+	// touch sensor is read as edge events from the gpio character device, polled only when the device is not there
+	chipPath := os.Getenv("GPIO_CHIP")
+	if chipPath == "" {
+		chipPath = digital.DEFAULT_GPIOCHIP
+	}
+	chip, err := digital.OpenGpioChip(chipPath)
+	if err != nil {
+		log.Warnf("touch sensor will be polled: %s", err)
+		chip = nil
+	}
+
+	// error led blinks out the faults for someone standing at the enclosure
+	errled := digital.NewErrLED(os.Getenv("GPIO_ERRLED"), r).Boot()
+	errled.Blink(ctx, &wg)
+	if !config.IsValid() {
+		errled.Raise(digital.FAULT_CONFIG, fmt.Errorf("invalid configuration in %s", os.Getenv("PATH_APPCONFIG")))
+	}
+	// live configuration is what the schedule, relay limits, touch actions & alarms go by, and is swapped on reload
+	// hardware is setup only once from the configuration at start
+	var live atomic.Pointer[aquacfg.AppConfig]
+	live.Store(&config)
+
+	// watchdog is fed only while the schedule, relay & sensor loops keep beating, a hung loop reboots the board
+	sup := watchdog.NewSupervisor()
+	stall := watchdog.DEFAULT_STALL
+	if config.Watchdog.Stall > 0 {
+		stall = time.Duration(config.Watchdog.Stall) * time.Second
+	}
+	if !config.Watchdog.Disabled {
+		path := config.Watchdog.Device
+		if path == "" {
+			path = watchdog.DEFAULT_DEVICE
+		}
+		if dev, err := watchdog.OpenDevice(path); err != nil {
+			log.Warnf("running without the hardware watchdog: %s", err)
+		} else {
+			sup.Feed(dev)
+		}
+	}
+	// systemd watchdog is fed alongside, and only when the service runs as Type=notify
+	sd := watchdog.NewNotifier()
+	if sd != nil {
+		sup.Feed(sd)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for err := range sup.Run(watchdog.FEED_INTERVAL, ctx, &wg) {
+			if err != nil {
+				log.Errorf("watchdog no longer fed, board would reboot: %s", err)
+				errled.RaiseFrom("watchdog", digital.FAULT_OTHER, err)
+			} else {
+				log.Warn("all loops alive again, watchdog fed")
+				errled.ClearFrom("watchdog")
+			}
+		}
+	}()
+
+	link := broker.NewLink(os.Getenv("AMQP_SERVER"), os.Getenv("AMQP_LOGIN"))
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		for intr := range interrupt.TouchOrSysSignal(os.Getenv("GPIO_TOUCH"), digital.SLOW_WATCH_3_3V, r, ctx, &wg) {
+		for up := range link.Watch(broker.REDIAL_INTERVAL, ctx, &wg) {
+			if up {
+				errled.Clear(digital.FAULT_BROKER)
+			} else {
+				errled.Raise(digital.FAULT_BROKER, link.Err())
+			}
+		}
+	}()
+
+	// Relay usage is restored before boot so that the accounting continues from the previous run
+	rs := digital.NewRelaySwitch(os.Getenv("GPIO_PUMP_MAIN"), false, r).WithLimits(dwellLimits(config.Relay))
+	rs.SetName("pump")
+	if pin := os.Getenv("GPIO_PUMP_FEEDBACK"); pin != "" {
+		// optional feedback input to verify the relay did switch
+		rs.WithFeedback(pin, func(err error) {
+			if err != nil {
+				errled.Raise(digital.FAULT_RELAY, err)
+			} else {
+				errled.Clear(digital.FAULT_RELAY)
+			}
+		})
+	}
+	statePath := config.Relay.StateFile
+	if statePath == "" {
+		statePath = DEFAULT_RELAY_STATEFILE
+	}
+	relayStats := digital.NewStatsFile(statePath)
+	if err := relayStats.Load(rs); err != nil {
+		log.Warnf("relay usage not restored, starting afresh: %s", err)
+	}
+	rs.Boot()
+	// variable speed pump is optional, when present the relay only powers the pump driver and schedule flips the pump speed
+	var pwm *digital.PwmPump
+	if pin := os.Getenv("GPIO_PUMP_PWM"); pin != "" {
+		flood := float64(config.Flow.Flood)
+		if flood == 0 {
+			flood = 100
+		}
+		pwm = digital.NewPwmPump(pin, r).WithLevels(flood, float64(config.Flow.Drain), float64(config.Flow.MinDuty)).Boot()
+		if err := rs.High(); err != nil {
+			log.Errorf("failed to power the pump driver: %s", err)
+		}
+		pwm.Drain() // till the schedule ticks, pump runs at the minimal inflow
+	}
+	st := rs.Stats()
+	log.WithFields(log.Fields{
+		"relay":    rs.Name(),
+		"hours":    fmt.Sprintf("%.2f", st.Hours()),
+		"switches": st.Switches,
+	}).Info("relay usage so far")
+	relayStats.Sync(RELAY_STATS_SYNC, ctx, &wg, rs)
+	// next switch as the schedule forecasts it, nil till the schedule starts or when the schedule is sensed rather than timed
+	var nextSwitch atomic.Pointer[tickers.Forecast]
+	// schedule, overrides and the safety interlocks all request the relay state on the arbiter, highest of them has its way
+	// with the pump driver the relay only powers it, schedule flips the pump speed directly
+	// relay is supervised through the arbiter, every switch and the arbiter watch beat it
+	relayBeat := sup.Register("relay", stall)
+	arb := control.NewArbiter(rs).WithBeat(watchdog.HEARTBEAT, relayBeat.Beat)
+	overridden := func() (control.Decision, bool) { // override by hand or remote in force
+		dec := arb.Decision()
+		return dec, dec.Source == control.SRC_MANUAL || dec.Source == control.SRC_REMOTE
+	}
+	sdStatus := func() {
+		pump := "OFF"
+		if pwm != nil && rs.IsHigh() {
+			pump = "DRAIN"
+			if pwm.IsFlooding() {
+				pump = "FLOOD"
+			}
+		} else if rs.IsHigh() {
+			pump = "ON"
+		}
+		status := fmt.Sprintf("pump %s", pump)
+		if dec, ok := overridden(); ok {
+			status = fmt.Sprintf("%s (%s, %s left)", status, dec.Source, dec.Remaining(time.Now()).Round(time.Second))
+		}
+		if fc := nextSwitch.Load(); fc != nil {
+			status = fmt.Sprintf("%s, next switch %s", status, fc.Next().Format("Jan-02 15:04"))
+		}
+		if err := sd.Status(status); err != nil {
+			log.Warnf("failed to notify systemd: %s", err)
+		}
+	}
+	// relay is booted and the config is loaded, systemd can start the dependent units
+	if err := sd.Ready(); err != nil {
+		log.Warnf("failed to notify systemd: %s", err)
+	}
+	sdStatus()
+
+	// drain flow sensor on the siphon outlet is optional
+	var drainFlow *digital.FlowSensor
+	var drainLPM atomic.Uint64                 // latest flow rate as float64 bits, for the display
+	var drainReadings chan digital.FlowReading // readings forwarded to the siphon control
+	if pin := os.Getenv("GPIO_FLOW_DRAIN"); pin != "" {
+		drainFlow = digital.NewFlowSensor(pin, config.FlowMeter.KFactor, r).WithChip(chip).Boot()
+		drainReadings = make(chan digital.FlowReading, 1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(drainReadings)
+			flowing := false
+			for rd := range drainFlow.Watch(digital.FLOW_POLL, digital.FLOW_REPORT, ctx, &wg) {
+				drainLPM.Store(math.Float64bits(rd.LPM))
+				select {
+				case <-drainReadings: // siphon control is lagging or not running, only the latest matters
+				default:
+				}
+				drainReadings <- rd
+				log.WithFields(log.Fields{
+					"lpm":    fmt.Sprintf("%.2f", rd.LPM),
+					"litres": fmt.Sprintf("%.1f", rd.Litres),
+				}).Trace("drain flow")
+				if now := rd.LPM > 0; now != flowing {
+					flowing = now
+					log.WithFields(log.Fields{
+						"flowing": flowing,
+						"litres":  fmt.Sprintf("%.1f", rd.Litres),
+					}).Info("drain flow changed")
+				}
+			}
+		}()
+	}
+
+	// dry run protection blocks the pump from switching on while the tank is low, no matter who asks for it
+	// latched till the water recovers, and the pump is tripped right away if it was running
+	dryRun := level.NewDryRunGuard(config.Tank.DryLitres, config.Tank.ReleaseAt)
+	rs.Guard(dryRun)
+	onDryRun := func(changed bool) {
+		if !changed {
+			return
+		}
+		if blocked, reason, _ := dryRun.Blocked(); blocked {
+			if err := rs.Trip(); err != nil {
+				log.Errorf("failed to trip pump on dry run: %s", err)
+			}
+			arb.Request(control.SRC_SAFETY, false, time.Time{}, reason) // tripped already, this keeps the others from asking for the pump
+			errled.RaiseFrom("dryrun", digital.FAULT_WATER, fmt.Errorf("%w: %s", level.ErrDryRun, reason))
+		} else {
+			log.Info("dry run block released, fish tank water recovered")
+			arb.Release(control.SRC_SAFETY, "fish tank water recovered")
+			errled.ClearFrom("dryrun")
+		}
+	}
+	// low water float switch in the fish tank is optional
+	if pin := os.Getenv("GPIO_FLOAT_LOW"); pin != "" {
+		lowFloat := digital.NewFloatSwitch(pin, true, r)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			floats := lowFloat.Watch(digital.FLOAT_WATCH, digital.FLOAT_DEBOUNCE, ctx, &wg)
+			for {
+				select {
+				case wet, ok := <-floats:
+					if !ok {
+						return
+					}
+					if wet {
+						log.Info("fish tank water above the low float")
+					} else {
+						log.Warn("fish tank water below the low float")
+					}
+					onDryRun(dryRun.Float(wet))
+				case <-time.After(10 * time.Second):
+					onDryRun(dryRun.Check()) // float recovery is timed
+				}
+			}
+		}()
+	}
+
+	// all the probes that are read periodically go on the one sampler, each at its own rate and filter
+	// readings then fan out to the display, logs and the alarms
+	smp := sensors.NewSampler()
+	every := func(secs int, d time.Duration) time.Duration {
+		if secs == 0 {
+			return d
+		}
+		return time.Duration(secs) * time.Second
+	}
+	// each sensor loop is supervised on its own, a probe that hangs is caught even while the others read fine
+	sensorBeats := map[string]*watchdog.Heartbeat{}
+	sample := func(s sensors.Sensor, interval time.Duration, f sensors.Filter) {
+		sensorBeats[s.ID()] = sup.Register("sensor."+s.ID(), stall+3*interval)
+		smp.Add(s, interval, f)
+	}
+	// alarms : sensor id to the check that raises a fault on the reading
+	alarms := map[string]func(rd sensors.Reading){}
+	inRange := func(source, what string, limits func(cfg *aquacfg.AppConfig) (float64, float64)) func(rd sensors.Reading) {
+		return func(rd sensors.Reading) {
+			min, max := limits(live.Load())
+			if (min != 0 || max != 0) && (rd.Value < min || rd.Value > max) {
+				errled.RaiseFrom(source, digital.FAULT_SENSOR, fmt.Errorf("%s %.2f%s beyond %.1f-%.1f", what, rd.Value, rd.Unit, min, max))
+			} else {
+				errled.ClearFrom(source)
+			}
+		}
+	}
+
+	// water temperature probes on the 1-Wire bus, daemon runs without them if none are found
+	waterProbe := "" // first probe is the one on the display, and the one pH is compensated to
+	if probes, err := onewire.Probes(config.Temp.Root); err != nil || len(probes) == 0 {
+		log.Warnf("no water temperature probes found: %v", err)
+	} else {
+		waterProbe = probes[0].ID()
+		for _, probe := range probes {
+			probe := probe
+			sample(sensors.Func(probe.ID(), "C", func(ctx context.Context) (float64, error) {
+				return probe.Read()
+			}), every(config.Temp.Interval, 1*time.Minute), newFilter(config.Temp.Filter))
+			alarms[probe.ID()] = inRange(probe.ID(), "water temperature", func(cfg *aquacfg.AppConfig) (float64, float64) {
+				return cfg.Temp.Min, cfg.Temp.Max
+			})
+		}
+	}
+
+	// pH probe on the ADC is optional, enabled only when calibrated
+	if len(config.PH.Calibration) > 0 {
+		addr, gain := config.PH.Address, analog.GAIN_4_096V
+		if addr == 0 {
+			addr = analog.ADS1115_ADDR
+		}
+		if config.PH.Gain != nil { // left out is the default, 0 is ±6.144V
+			gain = analog.Gain(*config.PH.Gain)
+		}
+		points := make([]analog.CalPoint, 0, len(config.PH.Calibration))
+		for _, pt := range config.PH.Calibration {
+			points = append(points, analog.CalPoint{PH: pt.PH, Volts: pt.Volts})
+		}
+		adc, err := analog.NewADS1115(r, analog.ADS1115_BUS, addr, gain)
+		var probe *analog.PHProbe
+		if err == nil {
+			probe, err = analog.NewPHProbe(adc, config.PH.Channel, points, config.PH.CalTemp, config.PH.Samples)
+		}
+		if err != nil {
+			errled.RaiseFrom("ph", digital.FAULT_CONFIG, err)
+		} else {
+			sample(sensors.Func("ph", "", func(ctx context.Context) (float64, error) {
+				// compensated to the water temperature when the probes have it
+				return probe.Read(smp.Value(waterProbe))
+			}), every(config.PH.Interval, 1*time.Minute), newFilter(config.PH.Filter))
+			alarms["ph"] = inRange("ph", "water pH", func(cfg *aquacfg.AppConfig) (float64, float64) {
+				return cfg.PH.Min, cfg.PH.Max
+			})
+		}
+	}
+
+	// ultrasonic level sensor over the fish tank is optional, needs the tank geometry to convert to litres
+	// leak alarm is latched till the tank is topped up or an operator acknowledges it on patioctl, hence the lock
+	var leaks *level.LeakDetector
+	var leakMu sync.Mutex
+	if trig, echo := os.Getenv("GPIO_LEVEL_TRIG"), os.Getenv("GPIO_LEVEL_ECHO"); trig != "" && echo != "" {
+		if config.Tank.Shape == "" {
+			errled.RaiseFrom("tank", digital.FAULT_CONFIG, fmt.Errorf("level sensor needs the tank geometry in configuration"))
+		} else {
+			us := digital.NewHCSR04(trig, echo, r)
+			def := func(val, d float64) float64 {
+				if val == 0 {
+					return d
+				}
+				return val
+			}
+			leaks = level.NewLeakDetector(level.LeakConfig{
+				Evaporation:   config.Tank.Evaporation,
+				CycleLitres:   config.Tank.CycleLitres,
+				SuddenLitres:  def(config.Tank.SuddenLitres, 10),
+				SuddenWindow:  time.Duration(def(float64(config.Tank.SuddenMins), 15)) * time.Minute,
+				SustainWindow: time.Duration(def(float64(config.Tank.SustainHours), 6)) * time.Hour,
+				Tolerance:     def(config.Tank.Tolerance, 5),
+			})
+			sample(sensors.Func("tank", "L", func(ctx context.Context) (float64, error) {
+				cm, err := us.Distance(5)
+				if err != nil {
+					return 0, err
+				}
+				return config.Tank.Litres(config.Tank.Level(cm)), nil
+			}), LEVEL_SAMPLING, newFilter(config.Tank.Filter))
+			alarms["tank"] = func(rd sensors.Reading) {
+				onDryRun(dryRun.Litres(rd.Value))
+				leakMu.Lock()
+				defer leakMu.Unlock()
+				if alarm := leaks.Add(rd.At, rd.Value); alarm != nil {
+					errled.RaiseFrom("leak", digital.FAULT_WATER, alarm)
+				} else {
+					errled.ClearFrom("leak")
+				}
+			}
+		}
+	}
+
+	logs, rules := smp.Subscribe(), smp.Subscribe()
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for rd := range logs {
+			if rd.Err != nil {
+				log.WithFields(log.Fields{"sensor": rd.ID}).Warnf("sensor reading: %s", rd.Err)
+				continue
+			}
 			log.WithFields(log.Fields{
-				"time": intr.Format(time.RFC822),
-			}).Warn("Interrupted...")
-			cancel() // time for all the program to go down
+				"sensor": rd.ID,
+				"raw":    fmt.Sprintf("%.2f", rd.Raw),
+				"value":  fmt.Sprintf("%.2f%s", rd.Value, rd.Unit),
+			}).Debug("sensor reading")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for rd := range rules {
+			if beat, ok := sensorBeats[rd.ID]; ok {
+				beat.Beat() // failed reading too, the loop is alive
+			}
+			if check, ok := alarms[rd.ID]; ok && rd.Err == nil {
+				check(rd)
+			}
 		}
 	}()
+	smp.Start(ctx, &wg)
+
+	nextPage := make(chan bool, 1) // cycles the display pages
+	redraw := make(chan bool, 1)   // renders the display out of turn
+	disp := oled.NewSundingOLED("oled", r)
+	flush_display := func() { // helps clear the display for prep and shutdown
+		log.Debug("Flushing display..")
+		disp.Clean()
+		disp.ResetImage().Render()
+	}
+	displayDone := make(chan bool) // display is flushed on shutdown only once it is done rendering
 	wg.Add(1)
 	go func() {
 		// display thread
 		defer wg.Done()
-		disp := oled.NewSundingOLED("oled", r)
-		flush_display := func() { // helps clear the display for prep and shutdown
-			log.Debug("Flushing display..")
-			disp.Clean()
-			disp.ResetImage().Render()
-		}
+		defer close(displayDone)
 		flush_display()
-		defer flush_display()
 
 		disp_date := func() string { // helps format current date as string
 			now := time.Now()
@@ -140,25 +539,114 @@ func main() {
 			hr, min, _ := now.Clock()
 			return fmt.Sprintf("%s-%02d %02d:%02d", mn.String()[:3], dd, hr, min)
 		}
-		disp.Message(10, 10, disp_date()).Render()
+		disp_usage := func() string { // cumulative pump on-time and switches
+			st := rs.Stats()
+			return fmt.Sprintf("%.1fh x%d", st.Hours(), st.Switches)
+		}
+		disp_pump := func() string { // current state of the pump
+			if blocked, _, _ := dryRun.Blocked(); blocked {
+				return "pump DRY RUN"
+			}
+			if rs.IsHigh() {
+				return "pump ON"
+			}
+			return "pump OFF"
+		}
+		disp_laston := func() string { // time the pump was last switched on
+			st := rs.Stats()
+			if st.LastOn.IsZero() {
+				return "on --:--"
+			}
+			return fmt.Sprintf("on %s", st.LastOn.Format("15:04"))
+		}
+		// each page is a set of lines on the display, double tap on the touch sensor cycles the pages
+		disp_flow := func() string { // flow out of the siphon
+			if drainFlow == nil {
+				return "flow --"
+			}
+			return fmt.Sprintf("flow %.1fL/m", math.Float64frombits(drainLPM.Load()))
+		}
+		disp_temp := func() string { // water temperature from the first probe
+			celsius := smp.Value(waterProbe)
+			if math.IsNaN(celsius) {
+				return "water --"
+			}
+			return fmt.Sprintf("water %.1fC", celsius)
+		}
+		disp_ph := func() string { // water pH
+			ph := smp.Value("ph")
+			if math.IsNaN(ph) {
+				return "pH --"
+			}
+			return fmt.Sprintf("pH %.2f", ph)
+		}
+		disp_tank := func() string { // volume in the fish tank, and leak if any
+			litres := smp.Value("tank")
+			if math.IsNaN(litres) {
+				return "tank --"
+			}
+			if _, leak := errled.Faults()[digital.FAULT_WATER]; leak {
+				return fmt.Sprintf("LEAK %.0fL", litres)
+			}
+			return fmt.Sprintf("tank %.0fL", litres)
+		}
+		pages := [][]func() string{
+			{disp_date, disp_usage, disp_temp},
+			{disp_pump, disp_laston, disp_flow},
+			{disp_temp, disp_ph, disp_tank},
+		}
+		disp_override := func() string { // countdown of the manual override
+			dec, _ := overridden()
+			state := "OFF"
+			if dec.On {
+				state = "ON"
+			}
+			left := dec.Remaining(time.Now())
+			return fmt.Sprintf("MAN %s %d:%02d", state, int(left.Minutes()), int(left.Seconds())%60)
+		}
+		disp_dryrun := func() string { return "DRY RUN" } // latched fault, pump is blocked till the water recovers
+		page := 0
+		render := func() {
+			disp.Clean()
+			for i, line := range pages[page] {
+				if i == 0 {
+					// fault and then the countdown take the first line on any page
+					if blocked, _, _ := dryRun.Blocked(); blocked {
+						line = disp_dryrun
+					} else if _, ok := overridden(); ok {
+						line = disp_override
+					}
+				}
+				disp.Message(10, 10+(i*20), line())
+			}
+			disp.Render()
+		}
+		render()
 		for {
+			refresh := 1 * time.Minute
+			if _, ok := overridden(); ok {
+				refresh = 1 * time.Second // countdown
+			}
 			select {
 			case <-ctx.Done():
 				return
-			case <-time.After(1 * time.Minute):
-				disp.Clean()
-				disp.Message(10, 10, disp_date()).Render()
+			case <-nextPage:
+				page = (page + 1) % len(pages)
+				render()
+			case <-redraw:
+				render()
+			case <-time.After(refresh):
+				render()
 			}
 		}
 	}()
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-
-		rs := digital.NewRelaySwitch(os.Getenv("GPIO_PUMP_MAIN"), false, r).Boot()
-		// TODO: This comes from configuration
+	// schedule : runs the pump schedule as per the configuration till the context is done
+	// config & ctx here are the ones the schedule runs with, reload restarts the schedule with the new configuration
+	schedule := func(config aquacfg.AppConfig, beat *watchdog.Heartbeat, ctx context.Context) {
 		var ticks chan time.Time
+		var commands chan control.Command // for schedules that set the pump state rather than flip it
+		nextSwitch.Store(nil)
 		if config.Schedule.Config == aquacfg.PULSE_EVERY_DAYAT {
 			/*At specfic times every day this will send a pulse of triggers for the pulse width as set
 			Intervals are irrelevant here since the cycle is always for 24 hours */
@@ -168,6 +656,7 @@ func main() {
 				"ticking time": config.Schedule.TickAt,
 			}).Debug("Schedule mode: Pulse everyday at")
 			ticks, _ = tickers.PulseEveryDayAt(config.Schedule.TickAt, pw, ctx, &wg)
+			nextSwitch.Store(tickers.DayAtForecast(config.Schedule.TickAt, pw))
 
 		} else if config.Schedule.Config == aquacfg.TICK_EVERY_DAYAT {
 			/*At specfic times every day this will send tick triggers
@@ -176,6 +665,7 @@ func main() {
 				"ticking time": config.Schedule.TickAt,
 			}).Debug("Schedule mode: Tick every day at")
 			ticks, _ = tickers.TickEveryDayAt(config.Schedule.TickAt, ctx, &wg)
+			nextSwitch.Store(tickers.DayAtForecast(config.Schedule.TickAt, 0))
 
 		} else if config.Schedule.Config == aquacfg.PULSE_EVERY {
 			/*For the given interval this can send pulse triggers for given pulse width
@@ -187,6 +677,7 @@ func main() {
 				"interval":  intrvl,
 			}).Debug("Schedule mode: Pulse every interval")
 			ticks = tickers.PulseEvery(intrvl, pw, ctx, &wg)
+			nextSwitch.Store(tickers.EveryForecast(intrvl, pw))
 
 		} else if config.Schedule.Config == aquacfg.TICK_EVERY {
 			/*For the given interval this can send tick triggers
@@ -196,21 +687,609 @@ func main() {
 				"interval": intrvl,
 			}).Debug("Schedule mode: Tick every interval")
 			ticks = tickers.TickEvery(intrvl, ctx, &wg)
+			nextSwitch.Store(tickers.EveryForecast(intrvl, 0))
+
+		} else if config.Schedule.Config == aquacfg.SIPHON_SENSE {
+			/*Pump is driven by the siphon state as read from the drain flow sensor
+			Interval & pulse gap are used only when sensing fails and it falls back to the timed pulse*/
+			if drainReadings == nil {
+				errled.Raise(digital.FAULT_CONFIG, fmt.Errorf("siphon sensing schedule needs the drain flow sensor, set GPIO_FLOW_DRAIN"))
+				arb.Release(control.SRC_SCHEDULE, "no drain flow sensor")
+				beat.Pause()
+				return
+			}
+			threshold, stale := config.Siphon.Threshold, config.Siphon.Stale
+			if threshold == 0 {
+				threshold = 0.5
+			}
+			if stale == 0 {
+				stale = 30
+			}
+			cfg := control.SiphonConfig{
+				Threshold:    threshold,
+				ResumeDelay:  time.Duration(config.Siphon.ResumeDelay) * time.Second,
+				FloodTimeout: time.Duration(config.Siphon.FloodTimeout) * time.Second,
+				DrainTimeout: time.Duration(config.Siphon.DrainTimeout) * time.Second,
+				Stale:        time.Duration(stale) * time.Second,
+				FallbackOn:   time.Duration(config.Schedule.PulseGap) * time.Second,
+				FallbackOff:  time.Duration(config.Schedule.Interval) * time.Second,
+			}
+			log.WithFields(log.Fields{
+				"threshold": cfg.Threshold,
+				"resume":    cfg.ResumeDelay,
+				"fallback":  fmt.Sprintf("%s/%s", cfg.FallbackOn, cfg.FallbackOff),
+			}).Debug("Schedule mode: Siphon sensing")
+			commands = control.SiphonLoop(drainReadings, cfg, ctx, &wg)
 
 		} else { // no suitable schedule configuration
-			log.Errorf("Invalid schedule configuration: %d", config.Schedule.Config)
-			cancel()
+			errled.Raise(digital.FAULT_CONFIG, fmt.Errorf("invalid schedule configuration: %d", config.Schedule.Config))
+			arb.Release(control.SRC_SCHEDULE, "invalid schedule")
+			beat.Pause()
 			return
 		}
-		for t := range ticks {
-			log.Debugf("Flipping the relay state: %s", t.Format(time.RFC822))
-			rs.Toggle()
+		// schedule requests the state it wants rather than flipping the relay, so that a rejected switch or an override does not leave it out of step
+		// restarted schedule picks up from the state it last requested
+		schedOn := rs.IsHigh()
+		if req, ok := arb.Requested(control.SRC_SCHEDULE); ok {
+			schedOn = req.On
 		}
+		request := func(on bool, reason string) {
+			schedOn = on
+			if err := arb.Request(control.SRC_SCHEDULE, on, time.Time{}, reason); errors.Is(err, control.ErrOverruled) {
+				log.Debugf("schedule held: %s", err)
+			} else if errors.Is(err, digital.ErrDeferred) {
+				log.Infof("schedule switch %s", err)
+			} else if err != nil {
+				log.Errorf("relay switch rejected: %s", err)
+			}
+		}
+		if pwm != nil {
+			request(true, "pump driver powered")
+		}
+		beat.Beat()
+		alive := time.NewTicker(watchdog.HEARTBEAT)
+		defer alive.Stop()
+		if commands != nil {
+		cmdLoop:
+			for {
+				var cmd control.Command
+				select {
+				case <-alive.C:
+					beat.Beat()
+					continue
+				case c, ok := <-commands:
+					if !ok {
+						break cmdLoop
+					}
+					cmd = c
+				}
+				beat.Beat()
+				if pwm != nil {
+					var err error
+					if cmd.Pump {
+						err = pwm.Flood()
+					} else {
+						err = pwm.Drain()
+					}
+					if err != nil {
+						log.Errorf("pump command rejected: %s", err)
+					}
+				} else {
+					request(cmd.Pump, cmd.Reason)
+				}
+				sdStatus()
+			}
+		} else {
+		tickLoop:
+			for {
+				var t time.Time
+				select {
+				case <-alive.C:
+					beat.Beat()
+					continue
+				case tk, ok := <-ticks:
+					if !ok {
+						break tickLoop
+					}
+					t = tk
+				}
+				beat.Beat()
+				nextSwitch.Load().Tick(t)
+				if pwm != nil {
+					log.Debugf("Flipping the pump speed: %s", t.Format(time.RFC822))
+					if err := pwm.Toggle(); err != nil {
+						log.Errorf("pump speed change failed: %s", err)
+					}
+					log.WithFields(log.Fields{
+						"level":    pwm.Level(),
+						"flooding": pwm.IsFlooding(),
+					}).Info("pump speed")
+					sdStatus()
+					continue
+				}
+				log.Debugf("Flipping the relay state: %s", t.Format(time.RFC822))
+				request(!schedOn, fmt.Sprintf("tick at %s", t.Format("15:04:05")))
+				st := rs.Stats()
+				log.WithFields(log.Fields{
+					"on":       rs.IsHigh(),
+					"hours":    fmt.Sprintf("%.2f", st.Hours()),
+					"switches": st.Switches,
+				}).Info("relay usage")
+				sdStatus()
+			}
+		}
+	}
 
-		rs.Low()
-		log.Warn("Now shutting down relay..")
+	reloads := make(chan aquacfg.AppConfig, 1) // reloaded configuration, schedule restarts with it
+	schedDone := make(chan bool)               // relays are put to safe state on shutdown only once the schedule is done switching them
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(schedDone)
+		// schedule is supervised only once it has started, invalid configuration should not reboot the board in a loop
+		var schedBeat *watchdog.Heartbeat
+		running := config
+		for {
+			schedCtx, schedCancel := context.WithCancel(ctx)
+			done := make(chan bool)
+			if running.IsValid() {
+				if schedBeat == nil {
+					schedBeat = sup.Register("schedule", stall)
+				}
+				go func() {
+					defer close(done)
+					schedule(running, schedBeat, schedCtx)
+				}()
+			} else {
+				// pump stays off, the error led keeps blinking till the configuration is fixed
+				log.Error("Schedule not started, invalid configuration")
+				close(done)
+			}
+			select {
+			case running = <-reloads:
+				schedCancel()
+				<-done // tickers are done once the schedule is
+				log.WithFields(log.Fields{
+					"sched": running.Schedule.Config,
+				}).Info("schedule restarting with the reloaded configuration")
+			case <-ctx.Done():
+				schedCancel()
+				<-done
+				return
+			}
+		}
+	}()
+	// reload : applies the configuration file afresh, without restarting the service
+	// schedule, relay limits, touch actions & alarm ranges take effect, hardware & sensors need a restart
+	// configuration comes in from the file and the api, applied one at a time
+	var cfgMu sync.Mutex
+	var cfgVersion atomic.Int64 // configurations applied since the start, for the metrics
+	cfgVersion.Store(1)
+	apply := func(cfg aquacfg.AppConfig) {
+		live.Store(&cfg)
+		cfgVersion.Add(1)
+		rs.WithLimits(dwellLimits(cfg.Relay))
+		errled.Clear(digital.FAULT_CONFIG)
+		select {
+		case <-reloads: // schedule has not picked the previous reload yet, only the latest matters
+		default:
+		}
+		reloads <- cfg
+		log.WithFields(log.Fields{
+			"sched":    cfg.Schedule.Config,
+			"tick":     cfg.Schedule.TickAt,
+			"interval": cfg.Schedule.Interval,
+			"pulsegap": cfg.Schedule.PulseGap,
+		}).Info("configuration reloaded")
+	}
+	reload := func() error {
+		sd.Reloading()
+		defer sd.Ready()
+		cfgMu.Lock()
+		defer cfgMu.Unlock()
+		cfg, err := readConfig(os.Getenv("PATH_APPCONFIG"))
+		if err != nil {
+			return fmt.Errorf("configuration not reloaded: %w", err)
+		}
+		if !cfg.IsValid() {
+			// running configuration is still good, no point stopping the pump over a typo
+			return fmt.Errorf("configuration not reloaded: invalid configuration in %s", os.Getenv("PATH_APPCONFIG"))
+		}
+		apply(cfg)
+		return nil
+	}
+	// override : forces the pump on / off out of the schedule for a while, args as in control.ParseOverride
+	// `resume` ends the override, and with no args a running override is ended else the pump is flipped for the default duration
+	// commands from the broker are remote overrides, the rest are by hand
+	override := func(args []string, origin string) error {
+		src := control.SRC_MANUAL
+		if origin == interrupt.ORIGIN_AMQP || origin == api.ORIGIN_HTTP {
+			src = control.SRC_REMOTE
+		}
+		if len(args) > 0 && args[0] == rs.Name() {
+			args = args[1:] // pump is the only relay there is
+		}
+		if len(args) > 0 && args[0] == "resume" {
+			arb.Release(src, fmt.Sprintf("resumed from %s", origin))
+			return nil
+		}
+		prev, running := arb.Requested(src)
+		if running && len(args) == 0 {
+			arb.Release(src, fmt.Sprintf("ended from %s", origin))
+			return nil
+		}
+		on, until, err := control.ParseOverride(args, rs.IsHigh(), time.Now())
+		if err != nil {
+			return err
+		}
+		if err := arb.Request(src, on, until, fmt.Sprintf("override from %s", origin)); errors.Is(err, digital.ErrDeferred) {
+			log.Infof("override %s", err) // applies once the relay can switch
+		} else if err != nil {
+			// arbiter has stored the rejected request in place of the earlier one, which would take effect later
+			if running {
+				arb.Request(prev.Source, prev.On, prev.Until, prev.Reason) // override in force is put back
+			} else {
+				arb.Release(src, "rejected")
+			}
+			return err
+		}
+		return nil
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for dec := range arb.Watch(ctx, &wg) {
+			fields := log.Fields{
+				"relay":  dec.Relay,
+				"on":     dec.On,
+				"source": dec.Source,
+				"reason": dec.Reason,
+			}
+			if !dec.Until.IsZero() {
+				fields["until"] = dec.Until.Format(time.RFC822)
+			}
+			if dec.Err != nil {
+				fields["err"] = dec.Err
+			}
+			log.WithFields(fields).Info("relay decision")
+			select {
+			case redraw <- true:
+			default: // redraw already pending
+			}
+			sdStatus()
+		}
+	}()
+	// relayStates : state of the relays and why, as the api has it
+	relayStates := func() []api.RelayState {
+		dec, st := arb.Decision(), rs.Stats()
+		state := api.RelayState{
+			Name:     rs.Name(),
+			On:       rs.IsHigh(),
+			Source:   dec.Source.String(),
+			Reason:   dec.Reason,
+			Hours:    st.Hours(),
+			Switches: st.Switches,
+		}
+		if !dec.Until.IsZero() {
+			state.Until = &dec.Until
+		}
+		if !st.LastOn.IsZero() {
+			state.LastOn = &st.LastOn
+		}
+		if !st.LastOff.IsZero() {
+			state.LastOff = &st.LastOff
+		}
+		if dec.Err != nil {
+			state.Err = dec.Err.Error()
+		}
+		return []api.RelayState{state}
+	}
+	// transitions : upcoming switches of the pump as the schedule forecasts them, and the end of the override if any
+	// schedule ticks while overridden are held, but they still flip the state the pump returns to
+	// with the pump driver on is flooding
+	transitions := func() []api.Transition {
+		trans := []api.Transition{}
+		dec, over := overridden()
+		on := false
+		if req, ok := arb.Requested(control.SRC_SCHEDULE); ok {
+			on = req.On
+		}
+		if pwm != nil {
+			on, over = pwm.IsFlooding(), false // speed is not held by the override
+		}
+		ticks := []time.Time{}
+		if fc := nextSwitch.Load(); fc != nil {
+			ticks = fc.Upcoming(NEXT_TRANSITIONS)
+		}
+		for _, at := range ticks {
+			if over && at.After(dec.Until) {
+				trans = append(trans, api.Transition{Relay: rs.Name(), At: dec.Until, On: on, Source: dec.Source.String()})
+				over = false
+			}
+			on = !on
+			if !over {
+				trans = append(trans, api.Transition{Relay: rs.Name(), At: at, On: on, Source: control.SRC_SCHEDULE.String()})
+			}
+		}
+		if over {
+			trans = append(trans, api.Transition{Relay: rs.Name(), At: dec.Until, On: on, Source: dec.Source.String()})
+		}
+		return trans
+	}
+	// statusFields : all that an operator would want to know, for the status dump and patioctl
+	statusFields := func() log.Fields {
+		fields := log.Fields{}
+		st := rs.Stats()
+		fields["relay."+rs.Name()] = fmt.Sprintf("on=%t hours=%.2f switches=%d", rs.IsHigh(), st.Hours(), st.Switches)
+		if pwm != nil {
+			fields["pump.level"] = fmt.Sprintf("%.0f%%", pwm.Level())
+		}
+		if blocked, reason, since := dryRun.Blocked(); blocked {
+			fields["dryrun"] = fmt.Sprintf("%s since %s", reason, since.Format(time.RFC822))
+		}
+		if fc := nextSwitch.Load(); fc != nil {
+			fields["next"] = fc.Next().Format(time.RFC822)
+		}
+		dec := arb.Decision()
+		fields["decision"] = fmt.Sprintf("on=%t by %s: %s", dec.On, dec.Source, dec.Reason)
+		if !dec.Until.IsZero() {
+			fields["decision"] = fmt.Sprintf("%s till %s", fields["decision"], dec.Until.Format(time.RFC822))
+		}
+		for _, rd := range smp.Readings() {
+			fields["sensor."+rd.ID] = fmt.Sprintf("%.2f%s at %s", rd.Value, rd.Unit, rd.At.Format("15:04:05"))
+		}
+		if drainFlow != nil {
+			fields["sensor.drain"] = fmt.Sprintf("%.2fL/m", math.Float64frombits(drainLPM.Load()))
+		}
+		fields["broker"] = "up"
+		if !link.Connected() {
+			fields["broker"] = fmt.Sprintf("down: %v", link.Err())
+		}
+		for code, err := range errled.Faults() {
+			fields["fault."+code.String()] = err.Error()
+		}
+		if err := sup.Check(); err != nil {
+			fields["watchdog"] = err.Error()
+		}
+		fields["sched"] = live.Load().Schedule.Config
+		return fields
+	}
+	// statusDump : one structured log line with the status
+	statusDump := func() {
+		log.WithFields(statusFields()).Info("status dump")
+	}
+	// backend : what the api and patioctl can see & do
+	backend := api.Backend{
+		Config: func() aquacfg.AppConfig { return *live.Load() },
+		SetConfig: func(cfg aquacfg.AppConfig) error {
+			sd.Reloading()
+			defer sd.Ready()
+			cfgMu.Lock()
+			defer cfgMu.Unlock()
+			// file is written first, so that the configuration outlives a restart
+			byt, err := json.MarshalIndent(cfg, "", "    ")
+			if err != nil {
+				return err
+			}
+			// written aside and renamed over, power cut halfway should not leave a truncated configuration to boot with
+			// deployment has PATH_APPCONFIG as a symlink, it is the file it points to that is replaced
+			path, err := filepath.EvalSymlinks(os.Getenv("PATH_APPCONFIG"))
+			if err != nil {
+				return fmt.Errorf("failed to resolve configuration path: %w", err)
+			}
+			tmp := path + ".tmp" // beside the target, rename does not cross file systems
+			if err := os.WriteFile(tmp, byt, 0664); err != nil {
+				return fmt.Errorf("failed to write configuration: %w", err)
+			}
+			if err := os.Rename(tmp, path); err != nil {
+				return fmt.Errorf("failed to replace configuration: %w", err)
+			}
+			apply(cfg)
+			return nil
+		},
+		Relays:  relayStates,
+		Next:    transitions,
+		Sensors: smp.Readings,
+		Override: func(relay string, args []string, origin string) error {
+			if relay != "" && relay != rs.Name() {
+				return fmt.Errorf("%w: %s", api.ErrNoRelay, relay)
+			}
+			return override(args, origin)
+		},
+		Reload: reload,
+		Acknowledge: func() error {
+			leakMu.Lock()
+			defer leakMu.Unlock()
+			if leaks == nil || !leaks.Acknowledge() {
+				return api.ErrNoAlarm
+			}
+			log.Warn("tank leak alarm acknowledged on patioctl")
+			errled.ClearFrom("leak")
+			return nil
+		},
+		Status:        func() map[string]interface{} { return statusFields() },
+		Broker:        link.Connected,
+		ConfigVersion: cfgVersion.Load,
+	}
+	// api is optional, for a look at the device over the local network, and for prometheus to scrape /metrics
+	if addr := os.Getenv("HTTP_ADDR"); addr != "" {
+		// without a token the api is read only, POST on /api/config & /api/override are refused
+		if err := api.NewServer(addr, backend).WithToken(os.Getenv("HTTP_TOKEN")).Start(ctx, &wg); err != nil {
+			log.Errorf("api not available: %s", err)
+		}
+	}
+	// control socket for patioctl, whoever can get on the box in the service group can control it
+	if err := api.NewControlSocket(os.Getenv("PATH_CTLSOCK"), backend).Start(ctx, &wg); err != nil {
+		log.Warnf("patioctl will not be able to connect: %s", err)
+	}
+	// interruptions from all the sources are fanned in to one loop
+	// touch & button gestures are mapped to actions from the live configuration, signals, remote commands & trigger files name the command
+	gestures := digital.DEFAULT_GESTURES
+	if config.Touch.HoldSecs > 0 {
+		gestures.LongPress = time.Duration(config.Touch.HoldSecs) * time.Second
+	}
+	sources := []interrupt.Source{
+		interrupt.NewSignalSource(),
+		interrupt.NewTouchSource(os.Getenv("GPIO_TOUCH"), gestures, chip, r),
+	}
+	if pin := os.Getenv("GPIO_BUTTON"); pin != "" {
+		sources = append(sources, interrupt.NewButtonSource(pin, digital.BTN_PULLUP, gestures, chip, r))
+	}
+	if queue := os.Getenv("AMQP_CMDQUEUE"); queue != "" {
+		sources = append(sources, interrupt.NewAMQPSource(link, queue))
+	}
+	if dir := os.Getenv("PATH_TRIGGERS"); dir != "" {
+		sources = append(sources, interrupt.NewFileSource(dir, interrupt.TRIGGER_POLL))
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for evt := range interrupt.Merge(ctx, &wg, sources...) {
+			command := evt.Kind
+			if evt.Origin == interrupt.ORIGIN_TOUCH || evt.Origin == interrupt.ORIGIN_BUTTON {
+				// stray touches no longer shutdown the application, only deliberate holds would
+				tap, hold, double := live.Load().Touch.Actions()
+				command = map[string]string{
+					digital.SHORT_PRESS.String():  tap,
+					digital.LONG_PRESS.String():   hold,
+					digital.DOUBLE_PRESS.String(): double,
+				}[evt.Kind]
+			}
+			log.WithFields(log.Fields{
+				"origin":  evt.Origin,
+				"kind":    evt.Kind,
+				"command": command,
+				"args":    evt.Args,
+			}).Info("interrupted")
+			if !evt.Permitted() {
+				log.Warnf("command %q not allowed from %s", command, evt.Origin)
+				continue
+			}
+			switch command {
+			case aquacfg.ACTION_SHUTDOWN:
+				log.WithFields(log.Fields{
+					"time": time.Now().Format(time.RFC822),
+				}).Warn("Interrupted...")
+				cancel() // time for all the program to go down
+			case interrupt.CMD_RELOAD.String():
+				if err := reload(); err != nil {
+					log.Error(err)
+				}
+			case interrupt.CMD_STATUS.String():
+				statusDump()
+			case aquacfg.ACTION_NEXTPAGE:
+				select {
+				case nextPage <- true:
+				default: // page change already pending
+				}
+			case aquacfg.ACTION_OVERRIDE:
+				// pump out of schedule for a while, schedule resumes once the override ends
+				if err := override(evt.Args, evt.Origin); err != nil {
+					log.Errorf("manual pump override rejected: %s", err)
+				}
+			case aquacfg.ACTION_NONE, "":
+			default:
+				log.Warnf("unknown command %q from %s", command, evt.Origin)
+			}
+		}
 	}()
-	// Flushing the hardware states
+
+	// Flushing the hardware states, in order : relays, watchdog, telemetry and then the display
+	// a step that is stuck is left behind, and a relay that could not be made safe leaves the watchdog armed to reboot the board
+	var relaysSafe atomic.Bool
+	stopper := shutdown.NewManager()
+	stopper.Register("relays", shutdown.PRIORITY_RELAYS, RELAY_SHUTDOWN, func(hctx context.Context) error {
+		select {
+		case <-schedDone:
+		case <-time.After(RELAY_SHUTDOWN / 2):
+			log.Warn("schedule did not stop in time, relays are put to safe state anyway")
+		}
+		if pwm != nil {
+			if err := pwm.ShutD(); err != nil {
+				log.Errorf("failed to stop the pump driver: %s", err)
+			}
+		}
+		safeOn := live.Load().Relay.SafeOn
+		log.WithFields(log.Fields{
+			"relay": rs.Name(),
+			"on":    safeOn,
+		}).Warn("Now shutting down relay..")
+		if err := rs.Force(safeOn); err != nil {
+			return err
+		}
+		relaysSafe.Store(true)
+		return nil
+	})
+	stopper.Register("watchdog", shutdown.PRIORITY_WATCHDOG, 0, func(hctx context.Context) error {
+		if !relaysSafe.Load() {
+			return fmt.Errorf("relays not in safe state, watchdog left armed to reboot the board")
+		}
+		return sup.Disarm()
+	})
+	stopper.Register("relay stats", shutdown.PRIORITY_TELEMETRY, 0, func(hctx context.Context) error {
+		return relayStats.Save(rs) // after the relays, so that the last switch is accounted
+	})
+	stopper.Register("display", shutdown.PRIORITY_DISPLAY, 0, func(hctx context.Context) error {
+		select {
+		case <-displayDone:
+		case <-hctx.Done():
+			return hctx.Err()
+		}
+		flush_display()
+		return nil
+	})
+	<-ctx.Done()
+	// systemd is told right away, feeding has stopped and the shutdown steps can take a while
+	// hardware watchdog is left to the watchdog step
+	if err := sd.Close(); err != nil {
+		log.Warnf("failed to notify systemd of the shutdown: %s", err)
+	}
+	stopper.Run()
 	wg.Wait()
 
 }
+
+// readConfig : reads the application configuration from the json file, at start and on reload
+func readConfig(path string) (aquacfg.AppConfig, error) {
+	cfg := aquacfg.AppConfig{}
+	f, err := os.Open(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to access application configuration file %s", err)
+	}
+	defer f.Close()
+	byt, err := io.ReadAll(f)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read config.json %s", err)
+	}
+	if err := json.Unmarshal(byt, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to unmarshal config.json %s", err)
+	}
+	return cfg, nil
+}
+
+// dwellLimits : relay protection limits as configured
+func dwellLimits(rc aquacfg.RelayConfig) digital.DwellLimits {
+	return digital.DwellLimits{
+		MinOn:      time.Duration(rc.MinOn) * time.Second,
+		MinOff:     time.Duration(rc.MinOff) * time.Second,
+		MaxPerHour: rc.MaxPerHour,
+		Queue:      rc.Queue,
+	}
+}
+
+// newFilter : sensor filter as configured, nil when the readings are taken as is
+func newFilter(fc aquacfg.FilterConfig) sensors.Filter {
+	window := fc.Window
+	if window == 0 {
+		window = 5
+	}
+	switch fc.Kind {
+	case aquacfg.FILTER_AVERAGE:
+		return sensors.NewMovingAverage(window)
+	case aquacfg.FILTER_MEDIAN:
+		return sensors.NewMedianFilter(window)
+	case aquacfg.FILTER_EXPONENTIAL:
+		return sensors.NewExponential(fc.Alpha) // zero takes the default
+	}
+	return nil
+}
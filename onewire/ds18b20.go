@@ -0,0 +1,182 @@
+package onewire
+
+/* ====================
+DS18B20 water temperature probes on the 1-Wire bus, read through the Linux w1 sysfs tree (w1-gpio & w1-therm modules)
+Each probe appears as a directory 28-xxxxxxxxxxxx under /sys/bus/w1/devices, reading w1_slave gives 2 lines like
+
+	72 01 4b 46 7f ff 0e 10 57 : crc=57 YES
+	72 01 4b 46 7f ff 0e 10 57 t=23125
+
+First line has the CRC check, second the temperature in milli degree celsius.
+Readings that fail the CRC are noise on the bus, and 85°C is what the probe reports when it has just powered up without a conversion - both are rejected.
+Root of the tree is configurable so that tests can use a fake directory.
+==================== */
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DEFAULT_W1_ROOT = "/sys/bus/w1/devices"
+	DS18B20_FAMILY  = "28-"  // family code prefix of the DS18B20 device ids
+	POWERON_MILLIC  = 85000  // power on reset value of the scratchpad
+	MIN_MILLIC      = -55000 // range of the probe as per the datasheet
+	MAX_MILLIC      = 125000 //
+	READ_RETRIES    = 3      // bus noise clears up on a retry more often than not
+)
+
+var (
+	ErrCRC     = errors.New("ds18b20 crc check failed")
+	ErrPowerOn = errors.New("ds18b20 reports power-on value 85°C")
+	ErrRange   = errors.New("ds18b20 reading beyond the probe range")
+	ErrFormat  = errors.New("ds18b20 unexpected w1_slave format")
+)
+
+// DS18B20 : temperature probe on the 1-Wire bus
+type DS18B20 struct {
+	root string
+	id   string
+}
+
+// NewDS18B20 : ctor for the probe
+// root		: root of the w1 sysfs tree, empty for DEFAULT_W1_ROOT
+// id		: device id as in the directory name, 28-xxxxxxxxxxxx
+func NewDS18B20(root, id string) *DS18B20 {
+	if root == "" {
+		root = DEFAULT_W1_ROOT
+	}
+	return &DS18B20{root: root, id: id}
+}
+
+// Probes : all the DS18B20 probes found under the root, sorted by their ids
+//
+/*
+	probes, err := onewire.Probes("")
+	if err != nil || len(probes) == 0 {
+		log.Warn("no temperature probes found")
+	}
+	celsius, err := probes[0].Read()
+*/
+func Probes(root string) ([]*DS18B20, error) {
+	if root == "" {
+		root = DEFAULT_W1_ROOT
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list 1-wire devices under %s: %w", root, err)
+	}
+	ids := []string{}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), DS18B20_FAMILY) {
+			ids = append(ids, e.Name())
+		}
+	}
+	sort.Strings(ids)
+	probes := make([]*DS18B20, 0, len(ids))
+	for _, id := range ids {
+		probes = append(probes, NewDS18B20(root, id))
+	}
+	return probes, nil
+}
+
+// ID : device id of the probe
+func (p *DS18B20) ID() string {
+	return p.id
+}
+
+// Read : temperature in celsius, retries on crc failures
+func (p *DS18B20) Read() (float64, error) {
+	var err error
+	for i := 0; i < READ_RETRIES; i++ {
+		var millic int
+		millic, err = p.readOnce()
+		if err == nil {
+			return float64(millic) / 1000, nil
+		}
+		if !errors.Is(err, ErrCRC) {
+			return 0, err
+		}
+	}
+	return 0, err
+}
+
+// readOnce : single read of the w1_slave file
+func (p *DS18B20) readOnce() (int, error) {
+	byt, err := os.ReadFile(filepath.Join(p.root, p.id, "w1_slave"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read probe %s: %w", p.id, err)
+	}
+	return parseSlave(string(byt))
+}
+
+// parseSlave : parses the contents of the w1_slave file to milli degree celsius
+func parseSlave(content string) (int, error) {
+	lines := strings.Split(strings.TrimSpace(content), "\n")
+	if len(lines) != 2 {
+		return 0, fmt.Errorf("%w: expected 2 lines got %d", ErrFormat, len(lines))
+	}
+	if !strings.HasSuffix(strings.TrimSpace(lines[0]), "YES") {
+		return 0, ErrCRC
+	}
+	// scratchpad bytes are checked here too, some kernel versions say YES on an all zero scratchpad
+	fields := strings.Fields(lines[0])
+	if len(fields) < 9 {
+		return 0, fmt.Errorf("%w: expected 9 scratchpad bytes in %q", ErrFormat, lines[0])
+	}
+	scratch := make([]byte, 9)
+	for i := range scratch {
+		b, err := strconv.ParseUint(fields[i], 16, 8)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s", ErrFormat, err)
+		}
+		scratch[i] = byte(b)
+	}
+	if crc8(scratch[:8]) != scratch[8] || allZero(scratch) {
+		return 0, ErrCRC
+	}
+	idx := strings.LastIndex(lines[1], "t=")
+	if idx < 0 {
+		return 0, fmt.Errorf("%w: no temperature in %q", ErrFormat, lines[1])
+	}
+	millic, err := strconv.Atoi(strings.TrimSpace(lines[1][idx+2:]))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrFormat, err)
+	}
+	if millic == POWERON_MILLIC {
+		return 0, ErrPowerOn
+	}
+	if millic < MIN_MILLIC || millic > MAX_MILLIC {
+		return 0, fmt.Errorf("%w: %d", ErrRange, millic)
+	}
+	return millic, nil
+}
+
+// crc8 : Dallas/Maxim 1-Wire CRC (polynomial x^8 + x^5 + x^4 + 1)
+func crc8(data []byte) byte {
+	crc := byte(0)
+	for _, b := range data {
+		for i := 0; i < 8; i++ {
+			mix := (crc ^ b) & 0x01
+			crc >>= 1
+			if mix != 0 {
+				crc ^= 0x8C
+			}
+			b >>= 1
+		}
+	}
+	return crc
+}
+
+func allZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package onewire
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeProbe : writes a w1_slave file under a fake sysfs root
+func fakeProbe(t *testing.T, root, id, content string) {
+	dir := filepath.Join(root, id)
+	assert.Nil(t, os.MkdirAll(dir, 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "w1_slave"), []byte(content), 0644))
+}
+
+func TestDS18B20Read(t *testing.T) {
+	root := t.TempDir()
+	fakeProbe(t, root, "28-000005e2fdc3", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=23125\n")
+	fakeProbe(t, root, "28-000005e2fdc4", "50 05 4b 46 7f ff 0c 10 1c : crc=1c YES\n50 05 4b 46 7f ff 0c 10 1c t=85000\n")
+	fakeProbe(t, root, "28-000005e2fdc5", "72 01 4b 46 7f ff 0e 10 57 : crc=57 NO\n72 01 4b 46 7f ff 0e 10 57 t=23125\n")
+	fakeProbe(t, root, "28-000005e2fdc6", "72 01 4b 46 7f ff 0e 10 58 : crc=58 YES\n72 01 4b 46 7f ff 0e 10 58 t=23125\n")
+	fakeProbe(t, root, "28-000005e2fdc7", "00 00 00 00 00 00 00 00 00 : crc=00 YES\n00 00 00 00 00 00 00 00 00 t=0\n")
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "w1_bus_master1"), 0755))
+
+	probes, err := Probes(root)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(probes), "only the DS18B20 family should be listed")
+
+	celsius, err := probes[0].Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 23.125, celsius)
+
+	_, err = probes[1].Read()
+	assert.True(t, errors.Is(err, ErrPowerOn), "Unexpected error %v", err)
+
+	_, err = probes[2].Read()
+	assert.True(t, errors.Is(err, ErrCRC), "kernel crc failure: %v", err)
+
+	_, err = probes[3].Read()
+	assert.True(t, errors.Is(err, ErrCRC), "scratchpad crc mismatch: %v", err)
+
+	_, err = probes[4].Read()
+	assert.True(t, errors.Is(err, ErrCRC), "all zero scratchpad: %v", err)
+
+	_, err = NewDS18B20(root, "28-missing").Read()
+	assert.NotNil(t, err)
+}
+
+func TestDS18B20Range(t *testing.T) {
+	_, err := parseSlave("72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=-127000\n")
+	assert.True(t, errors.Is(err, ErrRange), "Unexpected error %v", err)
+	_, err = parseSlave("garbage")
+	assert.True(t, errors.Is(err, ErrFormat), "Unexpected error %v", err)
+}
@@ -0,0 +1,93 @@
+package sensors
+
+import (
+	"sort"
+)
+
+const (
+	DEFAULT_ALPHA = 0.3 // weight of the latest value in the exponential filter, when none or one out of range is given
+)
+
+// Filter : smooths a series of readings, each value added gives back the smoothed value
+// Filters are not safe for concurrent use, sampler keeps one filter per sensor
+type Filter interface {
+	Add(v float64) float64
+}
+
+// MovingAverage : mean of the last n values
+type MovingAverage struct {
+	window []float64
+	size   int
+	sum    float64
+}
+
+// NewMovingAverage : ctor for the filter, n is atleast 1
+func NewMovingAverage(n int) *MovingAverage {
+	if n < 1 {
+		n = 1
+	}
+	return &MovingAverage{size: n}
+}
+
+func (ma *MovingAverage) Add(v float64) float64 {
+	ma.window = append(ma.window, v)
+	ma.sum += v
+	if len(ma.window) > ma.size {
+		ma.sum -= ma.window[0]
+		ma.window = ma.window[1:]
+	}
+	return ma.sum / float64(len(ma.window))
+}
+
+// MedianFilter : median of the last n values, throws away the odd spike that an average would smear
+type MedianFilter struct {
+	window []float64
+	size   int
+}
+
+// NewMedianFilter : ctor for the filter, n is atleast 1
+func NewMedianFilter(n int) *MedianFilter {
+	if n < 1 {
+		n = 1
+	}
+	return &MedianFilter{size: n}
+}
+
+func (mf *MedianFilter) Add(v float64) float64 {
+	mf.window = append(mf.window, v)
+	if len(mf.window) > mf.size {
+		mf.window = mf.window[1:]
+	}
+	sorted := append([]float64(nil), mf.window...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// Exponential : exponentially weighted moving average, alpha 0-1 is the weight of the latest value
+// first value is taken as is
+type Exponential struct {
+	alpha  float64
+	value  float64
+	primed bool
+}
+
+// NewExponential : ctor for the filter, alpha not within (0,1] falls back to DEFAULT_ALPHA
+func NewExponential(alpha float64) *Exponential {
+	if alpha <= 0 || alpha > 1 {
+		alpha = DEFAULT_ALPHA
+	}
+	return &Exponential{alpha: alpha}
+}
+
+func (ex *Exponential) Add(v float64) float64 {
+	if !ex.primed {
+		ex.value, ex.primed = v, true
+		return v
+	}
+	ex.value = ex.alpha*v + (1-ex.alpha)*ex.value
+	return ex.value
+}
@@ -0,0 +1,162 @@
+package sensors
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	SUBSCRIBER_BUFFER = 8 // readings a subscriber can lag behind before the oldest are dropped
+)
+
+// sampled : a sensor on the sampler, along with its rate and filter
+type sampled struct {
+	sensor   Sensor
+	interval time.Duration
+	filter   Filter
+}
+
+// Sampler : polls each sensor at its own rate, filters and fans out the readings to all the subscribers
+type Sampler struct {
+	mu      sync.Mutex
+	sensors []sampled
+	subs    []chan Reading
+	latest  map[string]Reading // last good reading of each sensor
+}
+
+// NewSampler : ctor for the sampler, add sensors and subscribers before Start
+/*
+	smp := sensors.NewSampler()
+	smp.Add(probe, 1*time.Minute, sensors.NewMedianFilter(5))
+	logs := smp.Subscribe()
+	smp.Start(ctx, &wg)
+	for rd := range logs {
+	}
+*/
+func NewSampler() *Sampler {
+	return &Sampler{latest: map[string]Reading{}}
+}
+
+// Add : sensor is read every interval, filter can be nil
+func (smp *Sampler) Add(s Sensor, interval time.Duration, f Filter) *Sampler {
+	smp.mu.Lock()
+	defer smp.mu.Unlock()
+	smp.sensors = append(smp.sensors, sampled{sensor: s, interval: interval, filter: f})
+	return smp
+}
+
+// Subscribe : channel on which all the readings are sent out, closed when the sampler stops
+// Subscriber that lags behind loses the oldest readings, and not the latest
+func (smp *Sampler) Subscribe() chan Reading {
+	smp.mu.Lock()
+	defer smp.mu.Unlock()
+	sub := make(chan Reading, SUBSCRIBER_BUFFER)
+	smp.subs = append(smp.subs, sub)
+	return sub
+}
+
+// Latest : last good reading of the sensor, false if there isnt any yet
+func (smp *Sampler) Latest(id string) (Reading, bool) {
+	smp.mu.Lock()
+	defer smp.mu.Unlock()
+	rd, ok := smp.latest[id]
+	return rd, ok
+}
+
+// Readings : last good reading of all the sensors, ordered by id
+func (smp *Sampler) Readings() []Reading {
+	smp.mu.Lock()
+	defer smp.mu.Unlock()
+	all := make([]Reading, 0, len(smp.latest))
+	for _, rd := range smp.latest {
+		all = append(all, rd)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+	return all
+}
+
+// Value : filtered value of the last good reading of the sensor, NaN if there isnt any yet
+func (smp *Sampler) Value(id string) float64 {
+	if rd, ok := smp.Latest(id); ok {
+		return rd.Value
+	}
+	return math.NaN()
+}
+
+// Start : each sensor is read right away and then every its interval, till the context is done
+// Subscriber channels are closed once all the sensors are done
+func (smp *Sampler) Start(ctx context.Context, wg *sync.WaitGroup) {
+	smp.mu.Lock()
+	all := append([]sampled(nil), smp.sensors...)
+	smp.mu.Unlock()
+	var running sync.WaitGroup
+	for _, s := range all {
+		s := s
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			next := time.After(0)
+			for {
+				select {
+				case <-next:
+					smp.publish(smp.sample(ctx, s))
+					next = time.After(s.interval)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer logrus.Warn("Now closing sensor sampler..")
+		defer wg.Done()
+		running.Wait()
+		smp.mu.Lock()
+		defer smp.mu.Unlock()
+		for _, sub := range smp.subs {
+			close(sub)
+		}
+	}()
+}
+
+// sample : reads the sensor once, reading is overdue after the interval
+func (smp *Sampler) sample(ctx context.Context, s sampled) Reading {
+	readCtx, cancel := context.WithTimeout(ctx, s.interval)
+	defer cancel()
+	val, err := s.sensor.Read(readCtx)
+	rd := Reading{ID: s.sensor.ID(), Unit: s.sensor.Unit(), At: time.Now(), Raw: val, Value: val, Err: err}
+	if err != nil {
+		rd.Raw, rd.Value = math.NaN(), math.NaN()
+		return rd
+	}
+	if s.filter != nil {
+		rd.Value = s.filter.Add(val) // each sensor has its own goroutine, filter is never shared
+	}
+	return rd
+}
+
+// publish : records the reading and sends it to all the subscribers
+func (smp *Sampler) publish(rd Reading) {
+	smp.mu.Lock()
+	defer smp.mu.Unlock()
+	if rd.Err == nil {
+		smp.latest[rd.ID] = rd
+	}
+	for _, sub := range smp.subs {
+		select {
+		case sub <- rd:
+		default:
+			select {
+			case <-sub: // subscriber is lagging, drop the oldest
+			default:
+			}
+			sub <- rd
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package sensors
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilters(t *testing.T) {
+	ma := NewMovingAverage(3)
+	for i, want := range []float64{3, 4.5, 5, 8} {
+		assert.Equal(t, want, ma.Add([]float64{3, 6, 6, 12}[i]), "moving average")
+	}
+	md := NewMedianFilter(3)
+	for i, want := range []float64{10, 30, 10, 11} {
+		assert.Equal(t, want, md.Add([]float64{10, 50, 9, 11}[i]), "median rejects the spike")
+	}
+	ex := NewExponential(0.5)
+	for i, want := range []float64{10, 15, 17.5} {
+		assert.Equal(t, want, ex.Add([]float64{10, 20, 20}[i]), "exponential")
+	}
+	assert.Equal(t, DEFAULT_ALPHA, NewExponential(0).alpha, "no alpha is the default, and not smoothing off")
+	assert.Equal(t, DEFAULT_ALPHA, NewExponential(1.5).alpha)
+}
+
+func TestSamplerFanOut(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	count := 0
+	good := Func("good", "C", func(ctx context.Context) (float64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		count++
+		return float64(count * 10), nil
+	})
+	bad := Func("bad", "pH", func(ctx context.Context) (float64, error) {
+		return 0, errors.New("probe disconnected")
+	})
+	smp := NewSampler().Add(good, 5*time.Millisecond, NewMovingAverage(2)).Add(bad, 5*time.Millisecond, nil)
+	subA, subB := smp.Subscribe(), smp.Subscribe()
+	smp.Start(ctx, &wg)
+
+	seen := map[string]int{}
+	for len(seen) < 2 || seen["good"] < 3 {
+		rd := <-subA
+		seen[rd.ID]++
+		if rd.ID == "bad" {
+			assert.NotNil(t, rd.Err)
+			assert.True(t, math.IsNaN(rd.Value))
+		}
+	}
+	rd, ok := smp.Latest("good")
+	assert.True(t, ok)
+	assert.NotEqual(t, rd.Raw, rd.Value, "filtered value differs from raw")
+	_, ok = smp.Latest("bad")
+	assert.False(t, ok, "failed readings are not the latest")
+	assert.True(t, math.IsNaN(smp.Value("bad")))
+
+	cancel()
+	wg.Wait()
+	// lagging subscriber has only the latest readings, and the channel is closed
+	n := 0
+	for range subB {
+		n++
+	}
+	assert.LessOrEqual(t, n, SUBSCRIBER_BUFFER)
+	_, open := <-subA
+	for open {
+		_, open = <-subA
+	}
+}
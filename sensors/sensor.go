@@ -0,0 +1,57 @@
+package sensors
+
+/* ====================
+Every probe on the system - water temperature, pH, tank level and whatever comes next - is a number read every so often.
+Sensor is that least common denominator, and the Sampler is the one pipeline that polls each sensor at its own rate, smooths the readings and fans them out to whoever is interested : display, logs, alarms and rules.
+Adding a probe is then writing a Sensor (or wrapping a read function with Func) and adding it to the sampler, not another goroutine in main.
+==================== */
+import (
+	"context"
+	"time"
+)
+
+// Sensor : anything that can be read for a single value
+type Sensor interface {
+	ID() string                                // unique across the sensors on the sampler
+	Unit() string                              // unit of the value, for display & logs
+	Read(ctx context.Context) (float64, error) // one reading, ctx is cancelled when the reading is overdue
+}
+
+// Reading : one reading from a sensor as sent out to the subscribers
+type Reading struct {
+	ID    string
+	Unit  string
+	At    time.Time
+	Raw   float64 // value as read from the sensor
+	Value float64 // value after the filter, same as Raw when the sensor has no filter
+	Err   error   // reading failed, values are not valid
+}
+
+// funcSensor : adapts a plain read function to Sensor
+type funcSensor struct {
+	id   string
+	unit string
+	read func(ctx context.Context) (float64, error)
+}
+
+// Func : wraps a read function as a Sensor, for drivers that do not implement Sensor themselves
+/*
+	probe := sensors.Func("ph", "pH", func(ctx context.Context) (float64, error) {
+		return phProbe.Read(25)
+	})
+*/
+func Func(id, unit string, read func(ctx context.Context) (float64, error)) Sensor {
+	return &funcSensor{id: id, unit: unit, read: read}
+}
+
+func (fs *funcSensor) ID() string {
+	return fs.id
+}
+
+func (fs *funcSensor) Unit() string {
+	return fs.unit
+}
+
+func (fs *funcSensor) Read(ctx context.Context) (float64, error) {
+	return fs.read(ctx)
+}
@@ -0,0 +1,128 @@
+package shutdown
+
+/* ====================
+Shutdown used to be a cancel() followed by wg.Wait(), with every goroutine cleaning up after itself as it pleased.
+The relay going low then raced with the display flush, and one goroutine stuck in cleanup kept the whole process (and the pump) from going down.
+Manager runs the cleanup hooks in the order of their priority - relays first, telemetry next, the display last - each with its own timeout.
+A hook that does not return within its timeout is left behind, and the shutdown moves on to the next one. How long each step took is logged.
+==================== */
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Priorities of the hooks, lower runs first
+const (
+	PRIORITY_RELAYS    = 0  // hardware that can do damage goes to its safe state before anything else
+	PRIORITY_WATCHDOG  = 5  // watchdog is disarmed only once the relays are safe
+	PRIORITY_TELEMETRY = 10 // usage & readings are flushed to disk / broker
+	PRIORITY_DISPLAY   = 20 // display & leds are cleared last
+
+	DEFAULT_TIMEOUT = 5 * time.Second
+)
+
+var (
+	ErrTimeout = errors.New("shutdown hook timed out")
+)
+
+// Hook : cleanup that runs on shutdown, ctx is done when the hook times out
+type Hook func(ctx context.Context) error
+
+type step struct {
+	name     string
+	priority int
+	timeout  time.Duration
+	hook     Hook
+}
+
+// Manager : runs the shutdown hooks in order of priority
+type Manager struct {
+	mu    sync.Mutex
+	steps []step
+	once  sync.Once
+}
+
+// NewManager : ctor for the manager, components register hooks as they are setup
+/*
+	stopper := shutdown.NewManager()
+	stopper.Register("relays", shutdown.PRIORITY_RELAYS, 5*time.Second, func(ctx context.Context) error {
+		return rs.Trip()
+	})
+	<-ctx.Done()
+	stopper.Run()
+*/
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+// Register : adds a hook, hooks of the same priority run in the order registered
+// zero timeout is DEFAULT_TIMEOUT
+func (m *Manager) Register(name string, priority int, timeout time.Duration, hook Hook) *Manager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if timeout <= 0 {
+		timeout = DEFAULT_TIMEOUT
+	}
+	m.steps = append(m.steps, step{name: name, priority: priority, timeout: timeout, hook: hook})
+	return m
+}
+
+// Run : runs all the hooks one after the another, only the first call runs them
+// returns the errors from the hooks by name, hooks that timed out have ErrTimeout
+func (m *Manager) Run() map[string]error {
+	errs := map[string]error{}
+	m.once.Do(func() {
+		m.mu.Lock()
+		steps := append([]step(nil), m.steps...)
+		m.mu.Unlock()
+		sort.SliceStable(steps, func(i, j int) bool { return steps[i].priority < steps[j].priority })
+		start := time.Now()
+		for _, s := range steps {
+			took, err := run(s)
+			entry := logrus.WithFields(logrus.Fields{
+				"step": s.name,
+				"took": took.Round(time.Millisecond),
+			})
+			if err != nil {
+				errs[s.name] = err
+				entry.Errorf("shutdown step failed: %s", err)
+				continue
+			}
+			entry.Info("shutdown step done")
+		}
+		logrus.WithFields(logrus.Fields{
+			"steps":  len(steps),
+			"failed": len(errs),
+			"took":   time.Since(start).Round(time.Millisecond),
+		}).Warn("shutdown complete")
+	})
+	return errs
+}
+
+// run : runs the hook, and gives up on it after its timeout
+func run(s step) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1) // hook left behind can still return, without anyone listening
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("shutdown hook panicked: %v", r)
+			}
+		}()
+		done <- s.hook(ctx)
+	}()
+	select {
+	case err := <-done:
+		return time.Since(start), err
+	case <-ctx.Done():
+		return time.Since(start), fmt.Errorf("%w: after %s", ErrTimeout, s.timeout)
+	}
+}
@@ -0,0 +1,54 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunInPriority(t *testing.T) {
+	var mu sync.Mutex
+	order := []string{}
+	hook := func(name string) Hook {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+	m := NewManager().
+		Register("display", PRIORITY_DISPLAY, 0, hook("display")).
+		Register("telemetry", PRIORITY_TELEMETRY, 0, hook("telemetry")).
+		Register("pump", PRIORITY_RELAYS, 0, hook("pump")).
+		Register("lights", PRIORITY_RELAYS, 0, hook("lights"))
+	assert.Empty(t, m.Run())
+	assert.Equal(t, []string{"pump", "lights", "telemetry", "display"}, order)
+	m.Run()
+	assert.Len(t, order, 4, "hooks run only once")
+}
+
+func TestStuckHookMovesOn(t *testing.T) {
+	ran := false
+	m := NewManager().
+		Register("stuck", PRIORITY_RELAYS, 20*time.Millisecond, func(ctx context.Context) error {
+			select {} // never returns, not even on ctx
+		}).
+		Register("failing", PRIORITY_TELEMETRY, 0, func(ctx context.Context) error {
+			return errors.New("disk full")
+		}).
+		Register("display", PRIORITY_DISPLAY, 0, func(ctx context.Context) error {
+			ran = true
+			return nil
+		})
+	start := time.Now()
+	errs := m.Run()
+	assert.Less(t, time.Since(start), time.Second)
+	assert.True(t, errors.Is(errs["stuck"], ErrTimeout))
+	assert.EqualError(t, errs["failing"], "disk full")
+	assert.True(t, ran, "later hooks run after a stuck one")
+}
@@ -0,0 +1,75 @@
+package tickers
+
+import (
+	"sync"
+	"time"
+)
+
+// Forecast : tells when the next tick of a ticker is due, for status & display
+// tickers do not expose their timers, hence the forecast is kept alongside and told of every tick that comes in
+type Forecast struct {
+	mu    sync.Mutex
+	next  time.Time
+	count int
+	after func(at time.Time, count int) time.Time // next tick after the tick at, count ticks so far
+}
+
+// EveryForecast : forecast for TickEvery (w = 0) and PulseEvery tickers, started now
+func EveryForecast(d, w time.Duration) *Forecast {
+	return &Forecast{
+		next: time.Now().Add(d),
+		after: func(at time.Time, count int) time.Time {
+			if w > 0 && count%2 == 1 {
+				return at.Add(w) // pulse is on, next tick ends it
+			}
+			return at.Add(d)
+		},
+	}
+}
+
+// DayAtForecast : forecast for TickEveryDayAt (w = 0) and PulseEveryDayAt tickers
+// next tick is worked out from the clock, ticks that come in are irrelevant
+func DayAtForecast(clock string, w time.Duration) *Forecast {
+	hr, min, _ := parse_clock(clock)
+	after := func(at time.Time, _ int) time.Time {
+		y, mn, dd := at.Date()
+		today := time.Date(y, mn, dd, int(hr), int(min), 0, 0, at.Location())
+		// pulse that started yesterday could still be on past midnight
+		for _, t := range []time.Time{today.AddDate(0, 0, -1).Add(w), today, today.Add(w), today.AddDate(0, 0, 1)} {
+			if t.After(at.Add(secondly)) {
+				return t
+			}
+		}
+		return today.AddDate(0, 0, 1)
+	}
+	return &Forecast{next: after(time.Now(), 0), after: after}
+}
+
+// Tick : records a tick from the ticker
+func (f *Forecast) Tick(at time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.count++
+	f.next = f.after(at, f.count)
+}
+
+// Next : time the next tick is due
+func (f *Forecast) Next() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.next
+}
+
+// Upcoming : next n ticks due, as they would come if the ticker carries on undisturbed
+func (f *Forecast) Upcoming(n int) []time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ticks := make([]time.Time, 0, n)
+	at, count := f.next, f.count
+	for i := 0; i < n; i++ {
+		ticks = append(ticks, at)
+		count++
+		at = f.after(at, count)
+	}
+	return ticks
+}
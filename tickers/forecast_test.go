@@ -0,0 +1,38 @@
+package tickers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEveryForecast(t *testing.T) {
+	f := EveryForecast(10*time.Minute, 2*time.Minute)
+	at := time.Date(2023, 1, 1, 10, 0, 0, 0, time.Local)
+	f.Tick(at)
+	assert.Equal(t, at.Add(2*time.Minute), f.Next(), "pulse on, next tick ends it")
+	f.Tick(at.Add(2 * time.Minute))
+	assert.Equal(t, at.Add(12*time.Minute), f.Next(), "pulse off, next tick after the interval")
+
+	plain := EveryForecast(5*time.Minute, 0)
+	plain.Tick(at)
+	assert.Equal(t, at.Add(5*time.Minute), plain.Next())
+	assert.Equal(t, []time.Time{at.Add(5 * time.Minute), at.Add(10 * time.Minute)}, plain.Upcoming(2))
+
+	f.Tick(at.Add(12 * time.Minute))
+	assert.Equal(t, []time.Time{at.Add(14 * time.Minute), at.Add(24 * time.Minute), at.Add(26 * time.Minute)}, f.Upcoming(3), "pulse on, off and on again")
+	assert.Equal(t, at.Add(14*time.Minute), f.Next(), "upcoming does not move the forecast")
+}
+
+func TestDayAtForecast(t *testing.T) {
+	f := DayAtForecast("13:30", 10*time.Minute)
+	day := func(hr, min int) time.Time { return time.Date(2023, 1, 1, hr, min, 0, 0, time.Local) }
+	assert.Equal(t, day(13, 30), f.after(day(9, 0), 0), "before the pulse")
+	assert.Equal(t, day(13, 40), f.after(day(13, 30), 1), "pulse on")
+	assert.Equal(t, day(13, 30).AddDate(0, 0, 1), f.after(day(13, 40), 2), "pulse off, tomorrow")
+
+	plain := DayAtForecast("13:30", 0)
+	assert.Equal(t, day(13, 30).AddDate(0, 0, 1), plain.after(day(13, 30), 1))
+	assert.Equal(t, day(13, 30), plain.after(day(0, 5), 0))
+}
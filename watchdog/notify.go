@@ -0,0 +1,83 @@
+package watchdog
+
+/* ====================
+systemd can tell when the hardware init is done and if the process is still alive only if the service tells it so - the sd_notify protocol.
+Service of Type=notify is given a unix datagram socket in $NOTIFY_SOCKET, and each datagram is a set of newline separated KEY=VALUE assignments.
+Notifier is also a Feeder for the Supervisor, so that WATCHDOG=1 goes out only while all the loops are alive, just as with the hardware watchdog.
+When not run under systemd there is no socket, and the notifier does nothing.
+==================== */
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+const (
+	NOTIFY_READY     = "READY=1"
+	NOTIFY_STOPPING  = "STOPPING=1"
+	NOTIFY_WATCHDOG  = "WATCHDOG=1"
+	NOTIFY_RELOADING = "RELOADING=1"
+)
+
+// Notifier : sends service state to systemd
+type Notifier struct {
+	addr *net.UnixAddr
+}
+
+// NewNotifier : notifier on $NOTIFY_SOCKET, nil when the service is not run by systemd
+// nil notifier is safe to use, it does nothing
+//
+/*
+	sd := watchdog.NewNotifier()
+	sup.Feed(sd)
+	sd.Ready()
+	sd.Status("pump OFF, next switch 13:30")
+*/
+func NewNotifier() *Notifier {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return nil
+	}
+	// abstract socket names start with @, that the net package takes care of
+	return &Notifier{addr: &net.UnixAddr{Name: path, Net: "unixgram"}}
+}
+
+// Notify : sends the state assignments as one datagram
+func (n *Notifier) Notify(state ...string) error {
+	if n == nil {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, n.addr)
+	if err != nil {
+		return fmt.Errorf("failed to reach systemd on %s: %w", n.addr.Name, err)
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(strings.Join(state, "\n")))
+	return err
+}
+
+// Ready : service is done with the startup
+func (n *Notifier) Ready() error {
+	return n.Notify(NOTIFY_READY)
+}
+
+// Reloading : service is reloading the configuration, Ready once done
+func (n *Notifier) Reloading() error {
+	return n.Notify(NOTIFY_RELOADING)
+}
+
+// Status : single line of status that systemctl status shows
+func (n *Notifier) Status(status string) error {
+	return n.Notify("STATUS=" + strings.ReplaceAll(status, "\n", " "))
+}
+
+// Feed : keeps the systemd watchdog (WatchdogSec) from restarting the service
+func (n *Notifier) Feed() error {
+	return n.Notify(NOTIFY_WATCHDOG)
+}
+
+// Close : service is going down
+func (n *Notifier) Close() error {
+	return n.Notify(NOTIFY_STOPPING)
+}
@@ -0,0 +1,42 @@
+package watchdog
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifier(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	var none *Notifier = NewNotifier()
+	assert.Nil(t, none, "no socket without systemd")
+	assert.Nil(t, none.Ready(), "nil notifier does nothing")
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	sock, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer sock.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+	sd := NewNotifier()
+	received := func() string {
+		buf := make([]byte, 256)
+		sock.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := sock.Read(buf)
+		assert.Nil(t, err)
+		return string(buf[:n])
+	}
+
+	assert.Nil(t, sd.Ready())
+	assert.Equal(t, "READY=1", received())
+	assert.Nil(t, sd.Status("pump ON\nnext switch 13:30"))
+	assert.Equal(t, "STATUS=pump ON next switch 13:30", received())
+	assert.Nil(t, sd.Feed())
+	assert.Equal(t, "WATCHDOG=1", received())
+	assert.Nil(t, sd.Close())
+	assert.Equal(t, "STOPPING=1", received())
+}
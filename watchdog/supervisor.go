@@ -0,0 +1,219 @@
+package watchdog
+
+/* ====================
+Box sits headless in the greenhouse, and a deadlocked goroutine there means the pump silently stays in whatever state it was in.
+Supervisor keeps the hardware watchdog (/dev/watchdog) fed, but only for as long as every loop that matters - schedule, relay, sensors - keeps beating its heartbeat.
+When any of them stalls, feeding stops and the board reboots once the watchdog times out. Relay is forced open on Boot, so the reboot lands the pump in its safe state.
+On a clean shutdown the watchdog is disarmed with the magic close, so that stopping the service does not reboot the box.
+If the shutdown could not get the relays to their safe state the watchdog is left armed, and the reboot takes care of it.
+==================== */
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DEFAULT_DEVICE = "/dev/watchdog"
+	FEED_INTERVAL  = 5 * time.Second  // well within the 15s the bcm2835 watchdog allows
+	HEARTBEAT      = 10 * time.Second // loops are expected to beat atleast this often
+	DEFAULT_STALL  = 1 * time.Minute  // loop that hasnt beat for this long is taken as hung
+)
+
+var (
+	ErrStalled = errors.New("heartbeat stalled")
+)
+
+// Feeder : anything that has to be kept fed while the application is healthy
+type Feeder interface {
+	Feed() error
+	Close() error // disarms the feeder on a clean shutdown
+}
+
+// Device : the hardware watchdog, board reboots if not fed within its timeout
+type Device struct {
+	f *os.File
+}
+
+// OpenDevice : opening the device arms the watchdog, it has to be fed from here on
+func OpenDevice(path string) (*Device, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open watchdog %s: %w", path, err)
+	}
+	return &Device{f: f}, nil
+}
+
+// Feed : any write other than the magic character resets the watchdog timer
+func (d *Device) Feed() error {
+	_, err := d.f.Write([]byte{0})
+	return err
+}
+
+// Close : writing V before closing is the magic close, that disarms the watchdog
+func (d *Device) Close() error {
+	if _, err := d.f.Write([]byte("V")); err != nil {
+		d.f.Close()
+		return err
+	}
+	return d.f.Close()
+}
+
+// Heartbeat : one supervised loop
+type Heartbeat struct {
+	name   string
+	stall  time.Duration
+	mu     sync.Mutex
+	last   time.Time
+	paused bool
+	now    func() time.Time
+}
+
+// Beat : loop is alive
+func (hb *Heartbeat) Beat() {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	hb.last, hb.paused = hb.now(), false
+}
+
+// Pause : loop has stopped on purpose, it is not supervised till it beats again
+func (hb *Heartbeat) Pause() {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	hb.paused = true
+}
+
+// stalled : true when the loop has not beat within its stall time
+func (hb *Heartbeat) stalled(at time.Time) bool {
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	return !hb.paused && at.Sub(hb.last) > hb.stall
+}
+
+// Supervisor : feeds the watchdogs only while all the heartbeats are alive
+type Supervisor struct {
+	mu      sync.Mutex
+	beats   []*Heartbeat
+	feeders []Feeder
+	now     func() time.Time
+}
+
+// NewSupervisor : ctor for the supervisor, register heartbeats & feeders before Run
+/*
+	sup := watchdog.NewSupervisor()
+	if dev, err := watchdog.OpenDevice(watchdog.DEFAULT_DEVICE); err == nil {
+		sup.Feed(dev)
+	}
+	beat := sup.Register("schedule", watchdog.DEFAULT_STALL)
+	for err := range sup.Run(watchdog.FEED_INTERVAL, ctx, &wg) {
+	}
+*/
+func NewSupervisor() *Supervisor {
+	return &Supervisor{now: time.Now}
+}
+
+// Feed : adds a watchdog to be fed
+func (sup *Supervisor) Feed(f Feeder) *Supervisor {
+	sup.mu.Lock()
+	defer sup.mu.Unlock()
+	sup.feeders = append(sup.feeders, f)
+	return sup
+}
+
+// Register : adds a loop to be supervised, loop has to beat within stall from here on
+func (sup *Supervisor) Register(name string, stall time.Duration) *Heartbeat {
+	sup.mu.Lock()
+	defer sup.mu.Unlock()
+	hb := &Heartbeat{name: name, stall: stall, now: sup.now}
+	hb.last = sup.now()
+	sup.beats = append(sup.beats, hb)
+	return hb
+}
+
+// Check : nil when all the heartbeats are alive, else ErrStalled with the loops that stalled
+func (sup *Supervisor) Check() error {
+	sup.mu.Lock()
+	defer sup.mu.Unlock()
+	at := sup.now()
+	stalled := []string{}
+	for _, hb := range sup.beats {
+		if hb.stalled(at) {
+			stalled = append(stalled, hb.name)
+		}
+	}
+	if len(stalled) == 0 {
+		return nil
+	}
+	sort.Strings(stalled)
+	return fmt.Errorf("%w: %s", ErrStalled, strings.Join(stalled, ", "))
+}
+
+// feed : feeds all the watchdogs
+func (sup *Supervisor) feed() {
+	sup.mu.Lock()
+	defer sup.mu.Unlock()
+	for _, f := range sup.feeders {
+		if err := f.Feed(); err != nil {
+			logrus.Errorf("failed to feed watchdog: %s", err)
+		}
+	}
+}
+
+// Disarm : closes all the watchdogs, for a clean shutdown
+// leaving them armed instead is the way to have the board reboot when the shutdown could not make the hardware safe
+func (sup *Supervisor) Disarm() error {
+	sup.mu.Lock()
+	defer sup.mu.Unlock()
+	errs := []error{}
+	for _, f := range sup.feeders {
+		if err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	sup.feeders = nil
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to disarm watchdog: %v", errs)
+	}
+	return nil
+}
+
+// Run : checks the heartbeats every interval and feeds the watchdogs while all are alive
+// health is sent out every time it changes, nil when healthy again
+// feeding stops when the context is done, Disarm has to follow or the board reboots
+func (sup *Supervisor) Run(interval time.Duration, ctx context.Context, wg *sync.WaitGroup) chan error {
+	health := make(chan error, 1)
+	wg.Add(1)
+	go func() {
+		defer logrus.Warn("Now closing watchdog supervisor..")
+		defer wg.Done()
+		defer close(health)
+		var last error
+		for {
+			err := sup.Check()
+			if err == nil {
+				sup.feed()
+			}
+			if (err == nil) != (last == nil) {
+				select {
+				case <-health: // only the latest health matters
+				default:
+				}
+				health <- err
+			}
+			last = err
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return health
+}
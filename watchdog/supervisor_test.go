@@ -0,0 +1,85 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckStalled(t *testing.T) {
+	at := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+	sup := NewSupervisor()
+	sup.now = func() time.Time { return at }
+	sched := sup.Register("schedule", time.Minute)
+	relay := sup.Register("relay", time.Minute)
+	assert.Nil(t, sup.Check())
+
+	at = at.Add(50 * time.Second)
+	relay.Beat()
+	at = at.Add(20 * time.Second)
+	err := sup.Check()
+	assert.True(t, errors.Is(err, ErrStalled))
+	assert.Contains(t, err.Error(), "schedule")
+	assert.NotContains(t, err.Error(), "relay")
+
+	sched.Beat()
+	assert.Nil(t, sup.Check(), "loop recovers when it beats again")
+
+	sched.Pause()
+	at = at.Add(5 * time.Minute)
+	relay.Beat()
+	assert.Nil(t, sup.Check(), "paused loop is not supervised")
+	at = at.Add(2 * time.Minute)
+	sched.Beat()
+	assert.NotNil(t, sup.Check(), "supervised again once it beats")
+}
+
+func TestDeviceFedOnlyWhileHealthy(t *testing.T) {
+	// plain file stands in for the watchdog device
+	path := filepath.Join(t.TempDir(), "watchdog")
+	assert.Nil(t, os.WriteFile(path, nil, 0644))
+	dev, err := OpenDevice(path)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	sup := NewSupervisor().Feed(dev)
+	hb := sup.Register("schedule", 30*time.Millisecond)
+	health := sup.Run(5*time.Millisecond, ctx, &wg)
+
+	stop := time.After(50 * time.Millisecond)
+	beating := true
+	for beating {
+		select {
+		case <-stop:
+			beating = false
+		case <-time.After(5 * time.Millisecond):
+			hb.Beat()
+		}
+	}
+	fed, _ := os.ReadFile(path)
+	assert.Greater(t, len(fed), 0, "fed while beating")
+
+	select {
+	case err := <-health:
+		assert.True(t, errors.Is(err, ErrStalled))
+	case <-time.After(time.Second):
+		t.Fatal("stall was not reported")
+	}
+	stalled, _ := os.ReadFile(path)
+	time.Sleep(20 * time.Millisecond)
+	after, _ := os.ReadFile(path)
+	assert.Equal(t, len(stalled), len(after), "not fed once stalled")
+
+	cancel()
+	wg.Wait()
+	assert.Nil(t, sup.Disarm())
+	closed, _ := os.ReadFile(path)
+	assert.Equal(t, byte('V'), closed[len(closed)-1], "magic close on shutdown")
+}